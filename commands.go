@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/vitoraalmeida/lenslocked/config"
+	"github.com/vitoraalmeida/lenslocked/migrations"
+	"github.com/vitoraalmeida/lenslocked/models"
+	"golang.org/x/term"
+)
+
+const usage = `Usage: lenslocked [flags] <command> [args]
+
+Commands:
+  serve [-migrate auto|check|off]           start the web server (default)
+  migrate up                                apply pending migrations
+  migrate down                              roll back the last migration
+  migrate status                            list applied and pending migrations
+  migrate create [-dir migrations] <name>   create a new SQL migration
+  user create -email <email> [-admin]       create a user, reading the password from stdin
+  user list                                 list users
+  user set-password -email <email>          change a password, reading it from stdin
+  user delete -email <email> -yes           permanently delete a user and their data
+  sessions purge [-email <email>]           sign out every user, or just one
+  jobs list                                 list the maintenance jobs and their schedules
+  jobs history                              show the latest job runs
+  jobs run <name>                           run a maintenance job now
+
+Flags:
+`
+
+// openDB abre a conexão usada pelos subcomandos
+func openDB(cfg config.Config) (*sql.DB, error) {
+	if cfg.Database.Driver == models.DriverSQLite {
+		db, err := models.OpenSQLite(cfg.Database.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Ping()
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("open db: %w", err)
+		}
+		return db, nil
+	}
+	// Open já espera o banco responder
+	return models.Open(models.PostgresConfig(cfg.PSQL))
+}
+
+// openReplica abre a réplica de leitura, ou retorna nil se ela não estiver
+// configurada
+func openReplica(cfg config.Config) (*sql.DB, error) {
+	if cfg.PSQL.ReplicaURL == "" {
+		return nil, nil
+	}
+	replica, err := models.Open(models.PostgresConfig(cfg.PSQL).ReplicaConfig())
+	if err != nil {
+		return nil, fmt.Errorf("open replica: %w", err)
+	}
+	return replica, nil
+}
+
+func migrateCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("migrate: missing subcommand (up, down, status or create)")
+	}
+	sub, args := args[0], args[1:]
+	if sub == "create" {
+		// não precisa do banco
+		flags := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+		dir := flags.String("dir", "migrations", "directory where the migration is created")
+		err := flags.Parse(args)
+		if err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("migrate create: expected a migration name")
+		}
+		return models.CreateMigration(*dir, flags.Arg(0))
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	switch sub {
+	case "up":
+		return models.MigrateFS(db, migrations.For(cfg.Database.Driver), ".")
+	case "down":
+		return models.MigrateDownFS(db, migrations.For(cfg.Database.Driver), ".")
+	case "status":
+		status, err := models.GetMigrationStatusFS(context.Background(), db, migrations.For(cfg.Database.Driver), ".")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("database version: %d\nlatest migration: %d\n", status.Current, status.Expected)
+		if len(status.Pending) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		for _, file := range status.Pending {
+			fmt.Printf("pending: %s\n", file)
+		}
+		return nil
+	default:
+		return fmt.Errorf("migrate: unknown subcommand %q", sub)
+	}
+}
+
+func userCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("user: missing subcommand (create, list, set-password or delete)")
+	}
+	sub, args := args[0], args[1:]
+	flags := flag.NewFlagSet("user "+sub, flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the user")
+	admin := flags.Bool("admin", false, "give the user access to the admin pages (create only)")
+	yes := flags.Bool("yes", false, "confirm the deletion (delete only)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if sub != "list" && *email == "" {
+		return fmt.Errorf("user %s: -email is required", sub)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+	userService := models.UserService{
+		DB: db,
+	}
+
+	switch sub {
+	case "create":
+		password, err := readPassword(os.Stdin, os.Stderr)
+		if err != nil {
+			return err
+		}
+		// sem a transação uma falha ao promover deixaria um usuário comum
+		// criado, e repetir o comando daria email já em uso
+		var user *models.User
+		err = models.InTx(ctx, db, func(ctx context.Context) error {
+			user, err = userService.Create(ctx, *email, password)
+			if err != nil {
+				return err
+			}
+			if *admin {
+				return userService.SetAdmin(ctx, user.ID, true)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created user %d (%s)\n", user.ID, user.Email)
+	case "list":
+		users, err := userService.List(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tEMAIL\tADMIN")
+		for _, user := range users {
+			fmt.Fprintf(tw, "%d\t%s\t%t\n", user.ID, user.Email, user.IsAdmin)
+		}
+		return tw.Flush()
+	case "set-password":
+		user, err := userService.ByEmail(ctx, *email)
+		if err != nil {
+			return err
+		}
+		password, err := readPassword(os.Stdin, os.Stderr)
+		if err != nil {
+			return err
+		}
+		err = userService.UpdatePassword(ctx, user.ID, password)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("password updated for %s\n", user.Email)
+	case "delete":
+		if !*yes {
+			return errors.New("user delete: this permanently removes the user and their data; pass -yes to confirm")
+		}
+		user, err := userService.ByEmail(ctx, *email)
+		if err != nil {
+			return err
+		}
+		err = userService.Delete(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("deleted user %d (%s)\n", user.ID, user.Email)
+	default:
+		return fmt.Errorf("user: unknown subcommand %q", sub)
+	}
+	return nil
+}
+
+func sessionsCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "purge" {
+		return errors.New("sessions: expected the purge subcommand")
+	}
+	flags := flag.NewFlagSet("sessions purge", flag.ContinueOnError)
+	email := flags.String("email", "", "only sign out this user")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+	sessionService := models.SessionService{
+		DB: db,
+	}
+
+	var n int64
+	if *email == "" {
+		n, err = sessionService.DeleteAll(ctx)
+	} else {
+		userService := models.UserService{
+			DB: db,
+		}
+		var user *models.User
+		user, err = userService.ByEmail(ctx, *email)
+		if err != nil {
+			return err
+		}
+		n, err = sessionService.DeleteForUser(ctx, user.ID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %d sessions\n", n)
+	return nil
+}
+
+// readPassword lê a senha sem eco quando a entrada é um terminal. Caso
+// contrário lê a primeira linha, o que permite usar um pipe em scripts.
+func readPassword(in *os.File, prompt io.Writer) (string, error) {
+	var password string
+	if term.IsTerminal(int(in.Fd())) {
+		fmt.Fprint(prompt, "Password: ")
+		b, err := term.ReadPassword(int(in.Fd()))
+		fmt.Fprintln(prompt)
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password = string(b)
+	} else {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("read password: password is empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,580 @@
+// Package config carrega a configuração da aplicação.
+//
+// Os valores são aplicados nesta ordem, cada etapa sobrescrevendo a anterior:
+//
+//  1. os defaults definidos na tag `default` dos campos
+//  2. um arquivo YAML (.yaml/.yml) ou TOML (.toml) opcional
+//  3. as variáveis de ambiente da tag `env`, que podem vir de um arquivo .env
+//     opcional (variáveis já definidas no ambiente têm prioridade sobre ele)
+//
+// Campos com a tag `secret` são omitidos quando a configuração é impressa.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// redacted substitui os valores secretos ao imprimir a configuração
+	redacted = "[redacted]"
+	// tamanho mínimo da chave usada pelo gorilla csrf para assinar os tokens
+	csrfKeyLen = 32
+)
+
+type Config struct {
+	// Env é o ambiente em que a aplicação está rodando: development ou
+	// production. Algumas páginas, como a visualização de emails, só existem
+	// em development
+	Env string `env:"APP_ENV" default:"development" yaml:"env" toml:"env"`
+	Log struct {
+		// debug, info, warn ou error
+		Level string `env:"LOG_LEVEL" default:"info" yaml:"level" toml:"level"`
+		// text ou json
+		Format string `env:"LOG_FORMAT" default:"text" yaml:"format" toml:"format"`
+	} `yaml:"log" toml:"log"`
+	Database struct {
+		// postgres ou sqlite. O SQLite guarda tudo em um arquivo e dispensa um
+		// servidor de banco, mas só pode ser usado por uma instância
+		Driver string `env:"DB_DRIVER" default:"postgres" yaml:"driver" toml:"driver"`
+		// arquivo do banco quando Driver é sqlite
+		SQLitePath string `env:"SQLITE_PATH" default:"lenslocked.db" yaml:"sqlite_path" toml:"sqlite_path"`
+	} `yaml:"database" toml:"database"`
+	PSQL Postgres `yaml:"psql" toml:"psql"`
+	SMTP SMTP     `yaml:"smtp" toml:"smtp"`
+	Mail struct {
+		// smtp, file ou memory. Vazio usa memory em development e smtp em
+		// production
+		Transport string `env:"MAIL_TRANSPORT" yaml:"transport" toml:"transport"`
+		// diretório usado pelo transporte file
+		Dir string `env:"MAIL_DIR" default:"tmp/mail" yaml:"dir" toml:"dir"`
+	} `yaml:"mail" toml:"mail"`
+	CSRF struct {
+		// chave usada pelo gorilla csrf para assinar os tokens. Em development
+		// uma chave aleatória é gerada quando nenhuma é informada
+		Key    string `env:"CSRF_KEY" secret:"true" yaml:"key" toml:"key"`
+		Secure bool   `env:"CSRF_SECURE" yaml:"secure" toml:"secure"`
+	} `yaml:"csrf" toml:"csrf"`
+	Server struct {
+		Address string `env:"SERVER_ADDRESS" default:":3000" yaml:"address" toml:"address"`
+		// BaseURL é o endereço público da aplicação usado nos links absolutos,
+		// como os enviados por email. Só esquema e host: a aplicação é servida
+		// na raiz. É obrigatório para servir: links com tokens nunca são
+		// gerados a partir da requisição. Em development o default é derivado
+		// de Address
+		BaseURL string `env:"BASE_URL" yaml:"base_url" toml:"base_url"`
+		// TrustProxy faz o IP do cliente ser lido do X-Forwarded-For
+		TrustProxy bool `env:"TRUST_PROXY" yaml:"trust_proxy" toml:"trust_proxy"`
+		// limites do http.Server. O ReadTimeout precisa ser longo o bastante
+		// para os uploads mais lentos
+		ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT" default:"5m" yaml:"read_timeout" toml:"read_timeout"`
+		ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" default:"10s" yaml:"read_header_timeout" toml:"read_header_timeout"`
+		WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT" default:"5m" yaml:"write_timeout" toml:"write_timeout"`
+		IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT" default:"2m" yaml:"idle_timeout" toml:"idle_timeout"`
+		MaxHeaderBytes    int           `env:"SERVER_MAX_HEADER_BYTES" default:"1048576" yaml:"max_header_bytes" toml:"max_header_bytes"`
+		// ShutdownTimeout é quanto tempo as requisições em andamento têm para
+		// terminar depois de um SIGTERM/SIGINT
+		ShutdownTimeout time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" default:"30s" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	} `yaml:"server" toml:"server"`
+	Metrics struct {
+		// Address é o endereço do listener que serve /metrics, separado do
+		// site. Vazio desabilita as métricas
+		Address string `env:"METRICS_ADDRESS" yaml:"address" toml:"address"`
+	} `yaml:"metrics" toml:"metrics"`
+	Tracing struct {
+		// none, otlp ou stdout. O exporter otlp usa as variáveis padrão do
+		// OpenTelemetry, como OTEL_EXPORTER_OTLP_ENDPOINT
+		Exporter    string  `env:"TRACING_EXPORTER" default:"none" yaml:"exporter" toml:"exporter"`
+		ServiceName string  `env:"TRACING_SERVICE_NAME" default:"lenslocked" yaml:"service_name" toml:"service_name"`
+		SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1" yaml:"sample_ratio" toml:"sample_ratio"`
+	} `yaml:"tracing" toml:"tracing"`
+	// TLS é habilitado quando CertFile e KeyFile são informados, para
+	// instalações que não usam um proxy reverso
+	TLS struct {
+		CertFile string `env:"TLS_CERT_FILE" yaml:"cert_file" toml:"cert_file"`
+		KeyFile  string `env:"TLS_KEY_FILE" yaml:"key_file" toml:"key_file"`
+		// 1.2 ou 1.3
+		MinVersion string `env:"TLS_MIN_VERSION" default:"1.2" yaml:"min_version" toml:"min_version"`
+		// RedirectAddress é o endereço de um listener HTTP que redireciona
+		// para HTTPS, por exemplo :80. Vazio não sobe o listener
+		RedirectAddress string `env:"TLS_REDIRECT_ADDRESS" yaml:"redirect_address" toml:"redirect_address"`
+		// HSTSMaxAge é o max-age do cabeçalho Strict-Transport-Security. 0
+		// desabilita o cabeçalho
+		HSTSMaxAge time.Duration `env:"TLS_HSTS_MAX_AGE" default:"8760h" yaml:"hsts_max_age" toml:"hsts_max_age"`
+		// ReloadInterval é de quanto em quanto tempo os arquivos são
+		// verificados. Um SIGHUP também recarrega o certificado
+		ReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL" default:"1m" yaml:"reload_interval" toml:"reload_interval"`
+	} `yaml:"tls" toml:"tls"`
+	Jobs struct {
+		// Enabled liga os jobs periódicos de manutenção neste processo. Mesmo
+		// com várias réplicas cada execução acontece em apenas uma delas
+		Enabled bool `env:"JOBS_ENABLED" default:"true" yaml:"enabled" toml:"enabled"`
+		// SessionMaxAge é a idade a partir da qual uma sessão é removida
+		SessionMaxAge time.Duration `env:"JOBS_SESSION_MAX_AGE" default:"720h" yaml:"session_max_age" toml:"session_max_age"`
+		// AuditRetention é por quanto tempo os eventos de auditoria são
+		// guardados
+		AuditRetention time.Duration `env:"JOBS_AUDIT_RETENTION" default:"8760h" yaml:"audit_retention" toml:"audit_retention"`
+		// HistoryRetention é por quanto tempo o histórico dos jobs é guardado
+		HistoryRetention time.Duration `env:"JOBS_HISTORY_RETENTION" default:"720h" yaml:"history_retention" toml:"history_retention"`
+		// EmailRetention é por quanto tempo os emails enviados ou desistidos
+		// ficam na fila de envio
+		EmailRetention time.Duration `env:"JOBS_EMAIL_RETENTION" default:"720h" yaml:"email_retention" toml:"email_retention"`
+	} `yaml:"jobs" toml:"jobs"`
+	Migrations struct {
+		// auto, check ou off. Vazio usa auto em development e check em
+		// production, onde as migrations devem ser aplicadas no deploy com
+		// "lenslocked migrate up"
+		Mode string `env:"MIGRATION_MODE" yaml:"mode" toml:"mode"`
+	} `yaml:"migrations" toml:"migrations"`
+	Registration struct {
+		// open, invite-only ou closed
+		Mode string `env:"REGISTRATION_MODE" default:"open" yaml:"mode" toml:"mode"`
+	} `yaml:"registration" toml:"registration"`
+}
+
+// Postgres tem os mesmos campos de models.PostgresConfig, então pode ser
+// convertido diretamente: models.PostgresConfig(cfg.PSQL)
+type Postgres struct {
+	// URL é uma connection string completa e, quando informada, substitui os
+	// campos de conexão abaixo
+	URL      string `env:"PSQL_URL" secret:"true" yaml:"url" toml:"url"`
+	Host     string `env:"PSQL_HOST" default:"localhost" yaml:"host" toml:"host"`
+	Port     string `env:"PSQL_PORT" default:"5432" yaml:"port" toml:"port"`
+	User     string `env:"PSQL_USER" default:"lenslocked" yaml:"user" toml:"user"`
+	Password string `env:"PSQL_PASSWORD" default:"lenslocked" secret:"true" yaml:"password" toml:"password"`
+	Database string `env:"PSQL_DATABASE" default:"lenslocked" yaml:"database" toml:"database"`
+	SSLMode  string `env:"PSQL_SSL_MODE" default:"disable" yaml:"ssl_mode" toml:"ssl_mode"`
+	// arquivos dos certificados, para sslmode verify-ca/verify-full e
+	// autenticação por certificado
+	SSLRootCert string `env:"PSQL_SSL_ROOT_CERT" yaml:"ssl_root_cert" toml:"ssl_root_cert"`
+	SSLCert     string `env:"PSQL_SSL_CERT" yaml:"ssl_cert" toml:"ssl_cert"`
+	SSLKey      string `env:"PSQL_SSL_KEY" yaml:"ssl_key" toml:"ssl_key"`
+
+	MaxOpenConns    int           `env:"PSQL_MAX_OPEN_CONNS" default:"20" yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `env:"PSQL_MAX_IDLE_CONNS" default:"10" yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `env:"PSQL_CONN_MAX_LIFETIME" default:"30m" yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `env:"PSQL_CONN_MAX_IDLE_TIME" default:"5m" yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	// ConnectTimeout é por quanto tempo a aplicação tenta se conectar ao
+	// subir antes de desistir
+	ConnectTimeout time.Duration `env:"PSQL_CONNECT_TIMEOUT" default:"30s" yaml:"connect_timeout" toml:"connect_timeout"`
+
+	// ReplicaURL é uma réplica de leitura opcional, usada pelas listagens
+	// administrativas, pela página de atividade e pelo export
+	ReplicaURL string `env:"PSQL_REPLICA_URL" secret:"true" yaml:"replica_url" toml:"replica_url"`
+}
+
+// SMTP tem os mesmos campos de models.SMTPConfig
+type SMTP struct {
+	Host     string `env:"SMTP_HOST" yaml:"host" toml:"host"`
+	Port     int    `env:"SMTP_PORT" default:"587" yaml:"port" toml:"port"`
+	Username string `env:"SMTP_USERNAME" yaml:"username" toml:"username"`
+	Password string `env:"SMTP_PASSWORD" secret:"true" yaml:"password" toml:"password"`
+}
+
+// Load lê a configuração. file é o caminho de um arquivo YAML ou TOML; vazio
+// usa CONFIG_FILE, se houver. O arquivo .env do diretório atual é lido se
+// existir, antes de tudo, então CONFIG_FILE também pode ser definido nele.
+func Load(file string) (Config, error) {
+	var cfg Config
+	err := walk(reflect.ValueOf(&cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		def, ok := field.Tag.Lookup("default")
+		if !ok {
+			return nil
+		}
+		return set(value, def)
+	})
+	if err != nil {
+		return cfg, fmt.Errorf("load config: %w", err)
+	}
+
+	// o godotenv não sobrescreve as variáveis já definidas no ambiente
+	err = godotenv.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return cfg, fmt.Errorf("load config: .env: %w", err)
+	}
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		err = loadFile(&cfg, file)
+		if err != nil {
+			return cfg, fmt.Errorf("load config: %w", err)
+		}
+	}
+	err = walk(reflect.ValueOf(&cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		env, ok := os.LookupEnv(name)
+		if !ok || env == "" {
+			return nil
+		}
+		err := set(value, env)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return cfg, fmt.Errorf("load config: %w", err)
+	}
+
+	cfg.applyEnvDefaults()
+	err = cfg.Validate()
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Logger cria o logger da aplicação conforme LOG_LEVEL e LOG_FORMAT
+func (cfg Config) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	// o nível já foi verificado em Validate
+	level.UnmarshalText([]byte(cfg.Log.Level))
+	opts := slog.HandlerOptions{Level: level}
+	if cfg.Log.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, &opts))
+	}
+	return slog.New(slog.NewTextHandler(w, &opts))
+}
+
+// TLSEnabled indica se o servidor deve servir HTTPS diretamente
+func (cfg Config) TLSEnabled() bool {
+	return cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != ""
+}
+
+// TLSMinVersion converte TLS.MinVersion para a constante do crypto/tls
+func (cfg Config) TLSMinVersion() (uint16, error) {
+	switch cfg.TLS.MinVersion {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, got %q", cfg.TLS.MinVersion)
+}
+
+// applyEnvDefaults preenche os valores cujo default depende do ambiente
+func (cfg *Config) applyEnvDefaults() {
+	// com TLS os cookies só podem trafegar por HTTPS
+	if cfg.TLSEnabled() {
+		cfg.CSRF.Secure = true
+	}
+	if cfg.Mail.Transport == "" {
+		cfg.Mail.Transport = models.MailTransportSMTP
+		if cfg.Env == EnvDevelopment {
+			cfg.Mail.Transport = models.MailTransportMemory
+		}
+	}
+	if cfg.Migrations.Mode == "" {
+		cfg.Migrations.Mode = models.MigrationModeCheck
+		if cfg.Env == EnvDevelopment {
+			cfg.Migrations.Mode = models.MigrationModeAuto
+		}
+	}
+	if cfg.Server.BaseURL == "" && cfg.Env == EnvDevelopment {
+		cfg.Server.BaseURL = cfg.localBaseURL()
+	}
+}
+
+// localBaseURL monta a URL do servidor local a partir de Server.Address, ou
+// retorna vazio quando o endereço não é válido
+func (cfg Config) localBaseURL() string {
+	host, port, err := net.SplitHostPort(cfg.Server.Address)
+	if err != nil {
+		return ""
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// Validate verifica a configuração usada por todos os subcomandos, como a do
+// banco e a dos jobs, e em production recusa os defaults que só servem para
+// desenvolvimento. Todos os problemas encontrados são retornados de uma vez.
+// O que só o servidor usa é verificado por ValidateServe.
+func (cfg Config) Validate() error {
+	var p problems
+	cfg.validate(&p)
+	return p.err()
+}
+
+// ValidateServe verifica, além do que Validate verifica, a configuração usada
+// apenas pelo servidor: email, CSRF, endereço, TLS e afins. Assim os
+// subcomandos como "migrate up" rodam em production sem precisar dela.
+func (cfg Config) ValidateServe() error {
+	var p problems
+	cfg.validate(&p)
+	cfg.validateServe(&p)
+	return p.err()
+}
+
+// problems acumula as mensagens da validação
+type problems []string
+
+func (p *problems) add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p problems) err() error {
+	if len(p) > 0 {
+		return fmt.Errorf("invalid config:\n  - %s", strings.Join(p, "\n  - "))
+	}
+	return nil
+}
+
+func (cfg Config) validate(p *problems) {
+	add := p.add
+	switch cfg.Env {
+	case EnvDevelopment, EnvProduction:
+	default:
+		add("APP_ENV must be %q or %q, got %q", EnvDevelopment, EnvProduction, cfg.Env)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		add("LOG_LEVEL must be debug, info, warn or error, got %q", cfg.Log.Level)
+	}
+	if cfg.Log.Format != "text" && cfg.Log.Format != "json" {
+		add("LOG_FORMAT must be text or json, got %q", cfg.Log.Format)
+	}
+	switch cfg.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		add("TRACING_EXPORTER must be none, otlp or stdout, got %q", cfg.Tracing.Exporter)
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		add("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+	switch cfg.Database.Driver {
+	case models.DriverPostgres:
+		if cfg.PSQL.URL == "" && (cfg.PSQL.Host == "" || cfg.PSQL.Database == "" || cfg.PSQL.User == "") {
+			add("PSQL_HOST, PSQL_USER and PSQL_DATABASE are required unless PSQL_URL is set")
+		}
+		if cfg.PSQL.MaxOpenConns < 0 || cfg.PSQL.MaxIdleConns < 0 {
+			add("PSQL_MAX_OPEN_CONNS and PSQL_MAX_IDLE_CONNS can't be negative")
+		}
+		if cfg.PSQL.MaxOpenConns > 0 && cfg.PSQL.MaxIdleConns > cfg.PSQL.MaxOpenConns {
+			add("PSQL_MAX_IDLE_CONNS can't be greater than PSQL_MAX_OPEN_CONNS")
+		}
+	case models.DriverSQLite:
+		if cfg.Database.SQLitePath == "" {
+			add("SQLITE_PATH is required when DB_DRIVER is %q", models.DriverSQLite)
+		}
+		if cfg.PSQL.ReplicaURL != "" {
+			add("PSQL_REPLICA_URL can't be used when DB_DRIVER is %q", models.DriverSQLite)
+		}
+	default:
+		add("DB_DRIVER must be postgres or sqlite, got %q", cfg.Database.Driver)
+	}
+	if cfg.Jobs.SessionMaxAge <= 0 || cfg.Jobs.AuditRetention <= 0 || cfg.Jobs.HistoryRetention <= 0 ||
+		cfg.Jobs.EmailRetention <= 0 {
+		add("JOBS_SESSION_MAX_AGE, JOBS_AUDIT_RETENTION, JOBS_HISTORY_RETENTION and JOBS_EMAIL_RETENTION must be positive durations")
+	}
+
+	if cfg.Env == EnvProduction {
+		if cfg.Database.Driver == models.DriverPostgres && cfg.PSQL.URL == "" &&
+			(cfg.PSQL.Password == "" || cfg.PSQL.Password == models.DefaultPostgresConfig().Password) {
+			add("PSQL_PASSWORD must be set to a non-default value in production")
+		}
+	}
+}
+
+func (cfg Config) validateServe(p *problems) {
+	add := p.add
+	switch cfg.Mail.Transport {
+	case models.MailTransportSMTP:
+		if cfg.SMTP.Host == "" {
+			add("SMTP_HOST is required when MAIL_TRANSPORT is %q", models.MailTransportSMTP)
+		}
+		if cfg.SMTP.Port <= 0 {
+			add("SMTP_PORT must be a positive number")
+		}
+	case models.MailTransportFile:
+		if cfg.Mail.Dir == "" {
+			add("MAIL_DIR is required when MAIL_TRANSPORT is %q", models.MailTransportFile)
+		}
+	case models.MailTransportMemory:
+	default:
+		add("MAIL_TRANSPORT must be smtp, file or memory, got %q", cfg.Mail.Transport)
+	}
+	switch cfg.Migrations.Mode {
+	case models.MigrationModeAuto, models.MigrationModeCheck, models.MigrationModeOff:
+	default:
+		add("MIGRATION_MODE must be auto, check or off, got %q", cfg.Migrations.Mode)
+	}
+	if cfg.CSRF.Key != "" && len(cfg.CSRF.Key) < csrfKeyLen {
+		add("CSRF_KEY must have at least %d bytes", csrfKeyLen)
+	}
+	if cfg.Server.Address == "" {
+		add("SERVER_ADDRESS is required")
+	}
+	if cfg.Server.ReadTimeout <= 0 || cfg.Server.ReadHeaderTimeout <= 0 ||
+		cfg.Server.WriteTimeout <= 0 || cfg.Server.IdleTimeout <= 0 || cfg.Server.ShutdownTimeout <= 0 {
+		add("server timeouts must be positive durations")
+	}
+	if cfg.Server.MaxHeaderBytes <= 0 {
+		add("SERVER_MAX_HEADER_BYTES must be a positive number")
+	}
+	if cfg.TLSEnabled() {
+		if cfg.TLS.CertFile == "" || cfg.TLS.KeyFile == "" {
+			add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		_, err := cfg.TLSMinVersion()
+		if err != nil {
+			add("%v", err)
+		}
+		if cfg.TLS.HSTSMaxAge < 0 || cfg.TLS.ReloadInterval <= 0 {
+			add("TLS_HSTS_MAX_AGE and TLS_RELOAD_INTERVAL must be positive durations")
+		}
+	}
+	err := models.ValidRegistrationMode(cfg.Registration.Mode)
+	if err != nil {
+		add("REGISTRATION_MODE: %v", err)
+	}
+
+	if cfg.Env == EnvProduction {
+		if cfg.CSRF.Key == "" {
+			add("CSRF_KEY is required in production")
+		}
+		if !cfg.CSRF.Secure {
+			add("CSRF_SECURE must be true in production")
+		}
+		if cfg.Server.BaseURL == "" {
+			add("BASE_URL is required in production")
+		}
+		if cfg.Mail.Transport != models.MailTransportSMTP {
+			add("MAIL_TRANSPORT must be %q in production", models.MailTransportSMTP)
+		}
+	}
+}
+
+// Print escreve a configuração efetiva em YAML, com os valores secretos
+// omitidos
+func (cfg Config) Print(w io.Writer) error {
+	err := walk(reflect.ValueOf(&cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		if field.Tag.Get("secret") == "true" && value.Kind() == reflect.String && value.String() != "" {
+			value.SetString(redacted)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("print config: %w", err)
+	}
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("print config: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func loadFile(cfg *Config, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	switch ext := filepath.Ext(file); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		// chaves desconhecidas geralmente são erros de digitação
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown keys %v", file, undecoded)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format %q", file, ext)
+	}
+	return nil
+}
+
+// walk chama fn para cada campo que não é uma struct, descendo pelas structs
+// aninhadas
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			err := walk(value, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := fn(field, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func set(value reflect.Value, s string) error {
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported config type %s", value.Type())
+	}
+	return nil
+}
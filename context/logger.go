@@ -0,0 +1,38 @@
+package context
+
+import (
+	"context"
+	"log/slog"
+)
+
+const (
+	loggerKey    key = "logger"
+	requestIDKey key = "request-id"
+)
+
+// WithLogger guarda o logger da requisição, que já carrega atributos como o
+// request ID
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// Logger retorna o logger guardado com WithLogger ou, se não houver um, o
+// logger padrão do slog
+func Logger(ctx context.Context) *slog.Logger {
+	val := ctx.Value(loggerKey)
+	logger, ok := val.(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+	return logger
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID retorna o ID da requisição atual, ou "" fora de uma requisição
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -9,7 +9,8 @@ import (
 type key string
 
 const (
-	userKey key = "user"
+	userKey         key = "user"
+	impersonatorKey key = "impersonator"
 )
 
 func WithUser(ctx context.Context, user *models.User) context.Context {
@@ -24,3 +25,20 @@ func User(ctx context.Context) *models.User {
 	}
 	return user
 }
+
+// WithImpersonator guarda o admin que está visualizando o sistema como o
+// usuário definido com WithUser
+func WithImpersonator(ctx context.Context, admin *models.User) context.Context {
+	return context.WithValue(ctx, impersonatorKey, admin)
+}
+
+// Impersonator retorna o admin que está personificando o usuário atual, ou nil
+// caso a requisição não faça parte de uma personificação
+func Impersonator(ctx context.Context) *models.User {
+	val := ctx.Value(impersonatorKey)
+	admin, ok := val.(*models.User)
+	if !ok {
+		return nil
+	}
+	return admin
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitoraalmeida/lenslocked/context"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// formato usado pelos campos <input type="date">
+const dateLayout = "2006-01-02"
+
+type Admin struct {
+	Templates struct {
+		Users  Template
+		Audit  Template
+		Emails Template
+	}
+	Errors               Errors
+	UserService          *models.UserService
+	ImpersonationService *models.ImpersonationService
+	AuditService         *models.AuditService
+	EmailOutbox          *models.EmailOutbox
+	// Transactor grava a personificação e o evento de auditoria juntos
+	Transactor Transactor
+}
+
+func (a Admin) Users(w http.ResponseWriter, r *http.Request) {
+	a.renderUsers(w, r)
+}
+
+func (a Admin) renderUsers(w http.ResponseWriter, r *http.Request, errs ...error) {
+	var data struct {
+		Users  []models.User
+		Events []models.ImpersonationEvent
+	}
+	var err error
+	data.Users, err = a.UserService.List(r.Context())
+	if err != nil {
+		a.Errors.Render(w, r, err)
+		return
+	}
+	data.Events, err = a.ImpersonationService.Events(r.Context(), 20)
+	if err != nil {
+		a.Errors.Render(w, r, err)
+		return
+	}
+	a.Templates.Users.Execute(w, r, data, errs...)
+}
+
+// inicia uma sessão de personificação para o usuário indicado na url. A sessão
+// original do admin continua válida, o cookie de personificação apenas indica
+// ao UserMiddleware qual usuário deve ser usado no contexto
+func (a Admin) StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	admin := context.User(r.Context())
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		a.Errors.Render(w, r, models.ErrNotFound)
+		return
+	}
+	if userID == admin.ID {
+		a.renderUsers(w, r, errors.Public(fmt.Errorf("impersonate self"),
+			"You can't impersonate yourself."))
+		return
+	}
+	var imp *models.Impersonation
+	err = a.Transactor.InTx(r.Context(), func(ctx stdcontext.Context) error {
+		var err error
+		imp, err = a.ImpersonationService.Start(ctx, admin, userID)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(r, models.AuditImpersonationStarted)
+		event.ActorID = admin.ID
+		event.TargetID = userID
+		return writeAudit(ctx, a.AuditService, event)
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrImpersonateAdmin) {
+			err = errors.Public(err, "Admins can't be impersonated.")
+		}
+		a.renderUsers(w, r, err)
+		return
+	}
+	setCookie(w, r, CookieImpersonation, imp.Token)
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (a Admin) StopImpersonation(w http.ResponseWriter, r *http.Request) {
+	admin := context.Impersonator(r.Context())
+	if admin == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	token, err := readCookie(r, CookieImpersonation)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	err = a.Transactor.InTx(r.Context(), func(ctx stdcontext.Context) error {
+		err := a.ImpersonationService.Stop(ctx, admin.ID, token)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(r, models.AuditImpersonationStopped)
+		event.ActorID = admin.ID
+		if user := context.User(r.Context()); user != nil {
+			event.TargetID = user.ID
+		}
+		return writeAudit(ctx, a.AuditService, event)
+	})
+	if err != nil {
+		a.Errors.Render(w, r, err)
+		return
+	}
+	deleteCookie(w, CookieImpersonation)
+	http.Redirect(w, r, "/admin/users", http.StatusFound)
+}
+
+// lista os eventos de auditoria de todos os usuários. Os filtros são lidos da
+// query string para que a url de uma busca possa ser compartilhada
+func (a Admin) Audit(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Action  string
+		Email   string
+		Since   string
+		Until   string
+		Actions []string
+		Events  []models.AuditEvent
+	}
+	data.Action = r.FormValue("action")
+	data.Email = r.FormValue("email")
+	data.Since = r.FormValue("since")
+	data.Until = r.FormValue("until")
+	data.Actions = []string{
+		models.AuditSignUp,
+		models.AuditSignIn,
+		models.AuditSignInFailed,
+		models.AuditSignOut,
+		models.AuditPasswordResetRequested,
+		models.AuditPasswordReset,
+		models.AuditInvitationSent,
+		models.AuditDataExported,
+		models.AuditDeletionRequested,
+		models.AuditDeletionCanceled,
+		models.AuditImpersonationStarted,
+		models.AuditImpersonationStopped,
+	}
+
+	filter := models.AuditFilter{
+		Action: data.Action,
+		Email:  data.Email,
+		Limit:  200,
+	}
+	var errs []error
+	if data.Since != "" {
+		since, err := time.Parse(dateLayout, data.Since)
+		if err != nil {
+			errs = append(errs, errors.Public(err, "Invalid start date."))
+		}
+		filter.Since = since
+	}
+	if data.Until != "" {
+		until, err := time.Parse(dateLayout, data.Until)
+		if err != nil {
+			errs = append(errs, errors.Public(err, "Invalid end date."))
+		} else {
+			// inclui o dia inteiro informado
+			filter.Until = until.AddDate(0, 0, 1)
+		}
+	}
+	if len(errs) == 0 {
+		var err error
+		data.Events, err = a.AuditService.List(r.Context(), filter)
+		if err != nil {
+			a.Errors.Render(w, r, err)
+			return
+		}
+	}
+	a.Templates.Audit.Execute(w, r, data, errs...)
+}
+
+// lista os emails que não puderam ser enviados após todas as tentativas
+func (a Admin) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Emails []models.OutboxEmail
+	}
+	var err error
+	data.Emails, err = a.EmailOutbox.DeadLetters(r.Context(), 100)
+	if err != nil {
+		a.Errors.Render(w, r, err)
+		return
+	}
+	a.Templates.Emails.Execute(w, r, data)
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// monta um evento de auditoria com os dados de origem da requisição
+func auditEvent(r *http.Request, action string) models.AuditEvent {
+	return models.AuditEvent{
+		Action:    action,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+type auditRecorder interface {
+	Record(ctx context.Context, event models.AuditEvent) error
+}
+
+// writeAudit grava o evento com o ctx da transação da ação auditada: a ação e
+// o evento são confirmados ou desfeitos juntos, então nenhum evento fica sem
+// ação nem o contrário
+func writeAudit(ctx context.Context, as auditRecorder, event models.AuditEvent) error {
+	if as == nil {
+		return nil
+	}
+	return as.Record(ctx, event)
+}
+
+// recordAudit é usado para eventos sem uma mudança de estado a acompanhar,
+// como uma tentativa de login que falhou. Falhas ao registrá-los não devem
+// impedir a ação do usuário, então apenas registramos o erro
+func recordAudit(r *http.Request, as auditRecorder, event models.AuditEvent) {
+	if as == nil {
+		return
+	}
+	err := as.Record(r.Context(), event)
+	if err != nil {
+		logError(r, err)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
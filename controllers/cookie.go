@@ -6,7 +6,8 @@ import (
 )
 
 const (
-	CookieSession = "session"
+	CookieSession       = "session"
+	CookieImpersonation = "impersonation"
 )
 
 func newCookie(name, value string) *http.Cookie {
@@ -19,8 +20,11 @@ func newCookie(name, value string) *http.Cookie {
 	return &cookie
 }
 
-func setCookie(w http.ResponseWriter, name, value string) {
+// setCookie marca o cookie como Secure quando a requisição chegou por TLS,
+// assim o browser nunca o envia numa conexão sem criptografia
+func setCookie(w http.ResponseWriter, r *http.Request, name, value string) {
 	cookie := newCookie(name, value)
+	cookie.Secure = r.TLS != nil
 	http.SetCookie(w, cookie)
 }
 
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// Dev agrupa páginas que só devem ser registradas no ambiente de
+// desenvolvimento, como a visualização dos emails transacionais
+type Dev struct {
+	Templates struct {
+		Emails  Template
+		Mailbox Template
+	}
+	Errors       Errors
+	EmailService *models.EmailService
+	// Mailbox guarda os emails enviados quando MAIL_TRANSPORT=memory
+	MemoryMailer *models.MemoryMailer
+}
+
+func (d Dev) Emails(w http.ResponseWriter, r *http.Request) {
+	type preview struct {
+		Name    string
+		Subject string
+	}
+	var data struct {
+		Emails []preview
+	}
+	for _, name := range d.EmailService.PreviewNames() {
+		email, err := d.EmailService.Preview(name)
+		if err != nil {
+			d.Errors.Render(w, r, err)
+			return
+		}
+		data.Emails = append(data.Emails, preview{name, email.Subject})
+	}
+	d.Templates.Emails.Execute(w, r, data)
+}
+
+// Email renderiza um email com dados de exemplo. Por padrão mostra a versão em
+// HTML, ?format=text mostra a versão em texto puro
+func (d Dev) Email(w http.ResponseWriter, r *http.Request) {
+	email, err := d.EmailService.Preview(chi.URLParam(r, "name"))
+	if err != nil {
+		logError(r, err)
+		d.Errors.Render(w, r, models.ErrNotFound)
+		return
+	}
+	if r.FormValue("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "From: %s\nTo: %s\nSubject: %s\n\n%s", email.From, email.To, email.Subject, email.Plaintext)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, email.HTML)
+}
+
+// Mailbox lista os emails capturados pelo MemoryMailer, do mais recente para o
+// mais antigo
+func (d Dev) Mailbox(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Emails []models.CapturedEmail
+	}
+	data.Emails = d.MemoryMailer.Emails()
+	d.Templates.Mailbox.Execute(w, r, data)
+}
+
+// MailboxEmail mostra um email capturado. Assim como em Email, ?format=text
+// mostra a versão em texto puro
+func (d Dev) MailboxEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		d.Errors.Render(w, r, models.ErrNotFound)
+		return
+	}
+	email, ok := d.MemoryMailer.Email(id)
+	if !ok {
+		d.Errors.Render(w, r, models.ErrNotFound)
+		return
+	}
+	if r.FormValue("format") == "text" || email.HTML == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "From: %s\nTo: %s\nSubject: %s\n\n%s", email.From, email.To, email.Subject, email.Plaintext)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, email.HTML)
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// Errors é a resposta padrão dos handlers quando algo falha. Cada controller
+// recebe o seu, montado em main.go
+type Errors struct {
+	// Page é a página HTML dos erros. Sem ela, como nos testes, a resposta é
+	// texto puro
+	Page Template
+}
+
+// domainErrors define o status e a mensagem padrão de cada erro de domínio.
+// Uma mensagem definida com errors.Public tem prioridade sobre a padrão
+var domainErrors = []struct {
+	err    error
+	status int
+	msg    string
+}{
+	{models.ErrNotFound, http.StatusNotFound, "We couldn't find what you were looking for."},
+	{models.ErrInvalidCredentials, http.StatusBadRequest, "Invalid email or password."},
+	{models.ErrExpiredToken, http.StatusBadRequest, "This link is invalid or has expired."},
+	{models.ErrConflict, http.StatusConflict, "That already exists."},
+	{models.ErrForbidden, http.StatusForbidden, "You are not allowed to do that."},
+}
+
+// errorStatus retorna o status HTTP de err e a mensagem que pode ser mostrada
+// ao usuário. Erros desconhecidos são falhas internas e não revelam nada.
+func errorStatus(err error) (int, string) {
+	status, msg := http.StatusInternalServerError, "Something went wrong."
+	for _, de := range domainErrors {
+		if errors.Is(err, de.err) {
+			status, msg = de.status, de.msg
+			break
+		}
+	}
+	if public, ok := errors.PublicMessage(err); ok {
+		msg = public
+	}
+	return status, msg
+}
+
+// publicError garante que err tenha uma mensagem pública, para ser passado
+// aos templates junto com o formulário
+func publicError(err error) error {
+	if _, ok := errors.PublicMessage(err); ok {
+		return err
+	}
+	_, msg := errorStatus(err)
+	return errors.Public(err, msg)
+}
+
+// Render responde com err. Erros de domínio viram o status correspondente,
+// como 404 para models.ErrNotFound; os demais são logados e viram 500.
+// Clientes que pedem JSON recebem {"error": "..."} e os outros a Page.
+func (e Errors) Render(w http.ResponseWriter, r *http.Request, err error) {
+	status, msg := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logError(r, err)
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if e.Page == nil {
+		http.Error(w, msg, status)
+		return
+	}
+	data := struct {
+		Status  int
+		Title   string
+		Message string
+	}{status, http.StatusText(status), msg}
+	e.Page.Execute(withStatus(w, status), r, data)
+}
+
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// withStatus faz a resposta sair com status em vez de 200 quando quem
+// escreve, como um Template, não define o status
+func withStatus(w http.ResponseWriter, status int) http.ResponseWriter {
+	return &statusWriter{ResponseWriter: w, status: status}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(sw.status)
+	}
+	return sw.ResponseWriter.Write(b)
+}
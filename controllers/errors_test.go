@@ -0,0 +1,63 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vitoraalmeida/lenslocked/controllers"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+func TestErrorsRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		msg    string
+	}{
+		{"not found", fmt.Errorf("by id: %w", models.ErrNotFound), http.StatusNotFound, "We couldn't find what you were looking for."},
+		{"specific error", models.ErrEmailTaken, http.StatusConflict, "That already exists."},
+		{"public message", errors.Public(models.ErrEmailTaken, "Email taken."), http.StatusConflict, "Email taken."},
+		{"forbidden", models.ErrNotAdmin, http.StatusForbidden, "You are not allowed to do that."},
+		{"internal", fmt.Errorf("connection refused"), http.StatusInternalServerError, "Something went wrong."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			controllers.Errors{}.Render(w, r, tt.err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			err := json.NewDecoder(w.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if body.Error != tt.msg {
+				t.Errorf("error = %q, want %q", body.Error, tt.msg)
+			}
+		})
+	}
+
+	t.Run("html", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", "text/html,application/xhtml+xml")
+		w := httptest.NewRecorder()
+		controllers.Errors{}.Render(w, r, fmt.Errorf("connection refused: password=secret"))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("body = %q, leaks the internal error", w.Body.String())
+		}
+	})
+}
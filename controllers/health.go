@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHealthTimeout is the default time each readiness check has to
+// finish.
+const DefaultHealthTimeout = 2 * time.Second
+
+// HealthCheck é uma dependência verificada pelo /readyz
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Health responde às probes do orquestrador. Os handlers não dependem de
+// sessão nem de CSRF, então devem ser registrados fora desses middlewares.
+// Como ficam públicos, as respostas trazem só o status e a latência de cada
+// verificação; os erros vão para o log.
+type Health struct {
+	Checks []HealthCheck
+	// Timeout defaults to DefaultHealthTimeout
+	Timeout time.Duration
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Live indica apenas que o processo está respondendo
+func (h Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready executa todas as verificações em paralelo e responde 503 se alguma
+// falhar
+func (h Health) Ready(w http.ResponseWriter, r *http.Request) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]checkResult, len(h.Checks))
+	healthy := true
+	for _, check := range h.Checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Check(ctx)
+			result := checkResult{
+				Status:    "ok",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "error"
+				logError(r, fmt.Errorf("readiness check %s: %w", check.Name, err))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.Name] = result
+			if err != nil {
+				healthy = false
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	data := struct {
+		Status string                 `json:"status"`
+		Checks map[string]checkResult `json:"checks"`
+	}{"ok", results}
+	status := http.StatusOK
+	if !healthy {
+		data.Status = "error"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
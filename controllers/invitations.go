@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/vitoraalmeida/lenslocked/context"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/urls"
+)
+
+// Invitations permite que usuários (e admins) convidem outras pessoas por
+// email. O convite é necessário para criar uma conta quando o cadastro está no
+// modo models.RegistrationInviteOnly
+type Invitations struct {
+	Templates struct {
+		New Template
+	}
+	Errors            Errors
+	InvitationService *models.InvitationService
+	EmailService      *models.EmailService
+	URLs              *urls.Builder
+	AuditService      *models.AuditService
+	RegistrationMode  string
+}
+
+func (inv Invitations) New(w http.ResponseWriter, r *http.Request) {
+	inv.render(w, r, "")
+}
+
+func (inv Invitations) render(w http.ResponseWriter, r *http.Request, email string, errs ...error) {
+	user := context.User(r.Context())
+	var data struct {
+		Email       string
+		Sent        string
+		Invitations []models.Invitation
+	}
+	data.Email = email
+	data.Sent = r.FormValue("sent")
+	var err error
+	data.Invitations, err = inv.InvitationService.ByInviter(r.Context(), user.ID)
+	if err != nil {
+		inv.Errors.Render(w, r, err)
+		return
+	}
+	inv.Templates.New.Execute(w, r, data, errs...)
+}
+
+func (inv Invitations) Create(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	email := r.FormValue("email")
+	if inv.RegistrationMode == models.RegistrationClosed {
+		inv.render(w, r, email, errors.Public(fmt.Errorf("registration closed"),
+			"Registration is closed, so invitations can't be used right now."))
+		return
+	}
+	invitation, err := inv.InvitationService.Create(r.Context(), email, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailTaken):
+			err = errors.Public(err, "That email address is already associated with an account.")
+		case errors.Is(err, models.ErrInvitationPending):
+			err = errors.Public(err, "Someone else has already invited that email address.")
+		}
+		inv.render(w, r, email, err)
+		return
+	}
+	vals := url.Values{
+		"token": {invitation.Token},
+	}
+	signupURL := inv.URLs.URL("/signup", vals)
+	err = inv.EmailService.Invite(r.Context(), invitation.Email, user.Email, signupURL)
+	if err != nil {
+		inv.Errors.Render(w, r, err)
+		return
+	}
+	event := auditEvent(r, models.AuditInvitationSent)
+	event.ActorID = user.ID
+	event.Email = invitation.Email
+	recordAudit(r, inv.AuditService, event)
+	http.Redirect(w, r, "/users/me/invitations?"+url.Values{"sent": {invitation.Email}}.Encode(), http.StatusFound)
+}
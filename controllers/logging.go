@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/context"
+	"github.com/vitoraalmeida/lenslocked/rand"
+)
+
+// HeaderRequestID é o cabeçalho usado para propagar o ID da requisição entre
+// o proxy, a aplicação e o cliente
+const HeaderRequestID = "X-Request-ID"
+
+// tamanho máximo de um request ID recebido de fora
+const maxRequestIDLen = 128
+
+// LoggingMiddleware atribui um ID a cada requisição, guarda no contexto um
+// logger com esse ID e registra um access log ao fim de cada requisição
+type LoggingMiddleware struct {
+	Logger *slog.Logger
+}
+
+// RequestID reaproveita o X-Request-ID enviado pelo proxy, se for válido, ou
+// gera um novo. O ID é devolvido no cabeçalho da resposta e incluído em todos
+// os logs feitos com context.Logger durante a requisição.
+func (lmw LoggingMiddleware) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			var err error
+			id, err = rand.String(12)
+			if err != nil {
+				lmw.Logger.Error("generating request id", "error", err)
+			}
+		}
+		w.Header().Set(HeaderRequestID, id)
+		ctx := context.WithRequestID(r.Context(), id)
+		ctx = context.WithLogger(ctx, lmw.Logger.With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AccessLog registra método, path, status, bytes escritos e latência de cada
+// requisição. Deve ser registrado depois de RequestID.
+func (lmw LoggingMiddleware) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		level := slog.LevelInfo
+		if rw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		context.Logger(r.Context()).Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rw.status,
+			"bytes", rw.bytes,
+			"duration", time.Since(start),
+			"ip", clientIP(r),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// responseRecorder guarda o status e a quantidade de bytes da resposta
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap permite que o http.ResponseController encontre o ResponseWriter
+// original, por exemplo para usar Flush
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// validRequestID aceita apenas IDs curtos com caracteres seguros para logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logError registra um erro inesperado no logger da requisição
+func logError(r *http.Request, err error) {
+	context.Logger(r.Context()).Error("request error", "error", err)
+}
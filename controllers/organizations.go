@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitoraalmeida/lenslocked/context"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/urls"
+)
+
+type Organizations struct {
+	Templates struct {
+		Index Template
+		Show  Template
+		Join  Template
+	}
+	Errors              Errors
+	OrganizationService *models.OrganizationService
+	Policy              *models.Policy
+	EmailService        *models.EmailService
+	URLs                *urls.Builder
+}
+
+func (o Organizations) Index(w http.ResponseWriter, r *http.Request) {
+	o.renderIndex(w, r, "")
+}
+
+func (o Organizations) renderIndex(w http.ResponseWriter, r *http.Request, name string, errs ...error) {
+	user := context.User(r.Context())
+	var data struct {
+		Name          string
+		Organizations []models.Organization
+	}
+	data.Name = name
+	var err error
+	data.Organizations, err = o.OrganizationService.ForUser(r.Context(), user.ID)
+	if err != nil {
+		o.Errors.Render(w, r, err)
+		return
+	}
+	o.Templates.Index.Execute(w, r, data, errs...)
+}
+
+func (o Organizations) Create(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	name := r.FormValue("name")
+	if name == "" {
+		o.renderIndex(w, r, name, errors.Public(fmt.Errorf("missing name"),
+			"Please provide a name for the organization."))
+		return
+	}
+	org, err := o.OrganizationService.Create(r.Context(), name, user.ID)
+	if err != nil {
+		o.renderIndex(w, r, name, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/organizations/%d", org.ID), http.StatusFound)
+}
+
+func (o Organizations) Show(w http.ResponseWriter, r *http.Request) {
+	org, ok := o.organization(w, r, models.ActionView)
+	if !ok {
+		return
+	}
+	o.renderShow(w, r, org)
+}
+
+func (o Organizations) renderShow(w http.ResponseWriter, r *http.Request, org *models.Organization, errs ...error) {
+	user := context.User(r.Context())
+	var data struct {
+		Organization *models.Organization
+		Members      []models.Member
+		CanManage    bool
+		Roles        []string
+		Sent         string
+	}
+	data.Organization = org
+	data.Roles = []string{models.RoleViewer, models.RoleEditor, models.RoleOwner}
+	data.Sent = r.FormValue("sent")
+	err := o.Policy.Authorize(r.Context(), user, models.ActionManage, models.OrganizationOwner(org.ID))
+	data.CanManage = err == nil
+	data.Members, err = o.OrganizationService.Members(r.Context(), org.ID)
+	if err != nil {
+		o.Errors.Render(w, r, err)
+		return
+	}
+	o.Templates.Show.Execute(w, r, data, errs...)
+}
+
+func (o Organizations) Invite(w http.ResponseWriter, r *http.Request) {
+	org, ok := o.organization(w, r, models.ActionManage)
+	if !ok {
+		return
+	}
+	user := context.User(r.Context())
+	email := r.FormValue("email")
+	invitation, err := o.OrganizationService.Invite(r.Context(), org.ID, email, r.FormValue("role"), user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRole) {
+			err = errors.Public(err, "Please choose a valid role.")
+		}
+		o.renderShow(w, r, org, err)
+		return
+	}
+	vals := url.Values{
+		"token": {invitation.Token},
+	}
+	joinURL := o.URLs.URL("/organizations/join", vals)
+	err = o.EmailService.OrganizationInvite(r.Context(), invitation.Email, user.Email, org.Name, joinURL)
+	if err != nil {
+		o.Errors.Render(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/organizations/%d?%s", org.ID,
+		url.Values{"sent": {invitation.Email}}.Encode()), http.StatusFound)
+}
+
+func (o Organizations) SetRole(w http.ResponseWriter, r *http.Request) {
+	org, ok := o.organization(w, r, models.ActionManage)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		o.Errors.Render(w, r, models.ErrNotFound)
+		return
+	}
+	err = o.OrganizationService.SetRole(r.Context(), org.ID, memberID, r.FormValue("role"))
+	if err != nil {
+		o.renderShow(w, r, org, memberError(err))
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/organizations/%d", org.ID), http.StatusFound)
+}
+
+// RemoveMember remove um membro da organização. Owners podem remover qualquer
+// membro e qualquer membro pode remover a si mesmo (sair da organização)
+func (o Organizations) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		o.Errors.Render(w, r, models.ErrNotFound)
+		return
+	}
+	action := models.ActionManage
+	if memberID == user.ID {
+		action = models.ActionView
+	}
+	org, ok := o.organization(w, r, action)
+	if !ok {
+		return
+	}
+	err = o.OrganizationService.RemoveMember(r.Context(), org.ID, memberID)
+	if err != nil {
+		o.renderShow(w, r, org, memberError(err))
+		return
+	}
+	if memberID == user.ID {
+		http.Redirect(w, r, "/organizations", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/organizations/%d", org.ID), http.StatusFound)
+}
+
+// dados usados pelo template de aceite de convite
+type joinData struct {
+	Token        string
+	Organization *models.Organization
+	Role         string
+}
+
+func (o Organizations) Join(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	invitation, err := o.OrganizationService.Invitation(r.Context(), token)
+	var data joinData
+	data.Token = token
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInvitation) {
+			err = errors.Public(err, "This invitation is invalid or has expired.")
+		}
+		o.Templates.Join.Execute(w, r, data, err)
+		return
+	}
+	data.Role = invitation.Role
+	data.Organization, err = o.OrganizationService.ByID(r.Context(), invitation.OrganizationID)
+	if err != nil {
+		o.Errors.Render(w, r, err)
+		return
+	}
+	o.Templates.Join.Execute(w, r, data)
+}
+
+func (o Organizations) ProcessJoin(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	org, err := o.OrganizationService.AcceptInvitation(r.Context(), r.FormValue("token"), user)
+	if err != nil {
+		var data joinData
+		if errors.Is(err, models.ErrInvalidInvitation) {
+			err = errors.Public(err, "This invitation is invalid, has expired or was sent to another email address.")
+		}
+		o.Templates.Join.Execute(w, r, data, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/organizations/%d", org.ID), http.StatusFound)
+}
+
+// organization busca a organização da url e verifica, através da Policy, se o
+// usuário atual pode executar a ação. Caso não possa, a resposta já é escrita
+// e ok será false
+func (o Organizations) organization(w http.ResponseWriter, r *http.Request, action models.Action) (*models.Organization, bool) {
+	user := context.User(r.Context())
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		o.Errors.Render(w, r, models.ErrNotFound)
+		return nil, false
+	}
+	err = o.Policy.Authorize(r.Context(), user, action, models.OrganizationOwner(id))
+	if err != nil {
+		// não revela a existência de organizações das quais o usuário não faz
+		// parte
+		if errors.Is(err, models.ErrForbidden) && action == models.ActionView {
+			err = models.ErrNotFound
+		}
+		o.Errors.Render(w, r, err)
+		return nil, false
+	}
+	org, err := o.OrganizationService.ByID(r.Context(), id)
+	if err != nil {
+		o.Errors.Render(w, r, err)
+		return nil, false
+	}
+	return org, true
+}
+
+func memberError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrLastOwner):
+		return errors.Public(err, "An organization must have at least one owner.")
+	case errors.Is(err, models.ErrInvalidRole):
+		return errors.Public(err, "Please choose a valid role.")
+	case errors.Is(err, models.ErrNotFound):
+		return errors.Public(err, "That user is not a member of this organization.")
+	}
+	return err
+}
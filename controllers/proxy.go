@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyMiddleware trata os cabeçalhos enviados pelo proxy reverso. Eles só
+// devem ser confiáveis (Trust) quando a aplicação não está exposta
+// diretamente, pois qualquer cliente pode enviá-los.
+type ProxyMiddleware struct {
+	Trust bool
+}
+
+// RealIP troca o RemoteAddr da requisição pelo IP do cliente informado em
+// X-Forwarded-For, assim a auditoria não registra o IP do proxy. Sem Trust a
+// requisição segue sem alterações.
+func (pmw ProxyMiddleware) RealIP(next http.Handler) http.Handler {
+	if !pmw.Trust {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(forwarded(r, "X-Forwarded-For")); ip != nil {
+			r.RemoteAddr = ip.String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwarded retorna o primeiro valor do cabeçalho. Quando há mais de um proxy
+// os valores são separados por vírgula, e o primeiro é o mais próximo do
+// cliente.
+func forwarded(r *http.Request, header string) string {
+	value, _, _ := strings.Cut(r.Header.Get(header), ",")
+	return strings.TrimSpace(value)
+}
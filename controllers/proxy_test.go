@@ -0,0 +1,40 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vitoraalmeida/lenslocked/controllers"
+)
+
+func TestProxyMiddlewareRealIP(t *testing.T) {
+	tests := map[string]struct {
+		trust  bool
+		header string
+		want   string
+	}{
+		"not trusted":    {trust: false, header: "203.0.113.7", want: "192.0.2.1:1234"},
+		"trusted":        {trust: true, header: "203.0.113.7, 10.0.0.1", want: "203.0.113.7"},
+		"trusted ipv6":   {trust: true, header: "2001:db8::1", want: "2001:db8::1"},
+		"invalid header": {trust: true, header: "not an ip", want: "192.0.2.1:1234"},
+		"no header":      {trust: true, want: "192.0.2.1:1234"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got string
+			h := controllers.ProxyMiddleware{Trust: tc.trust}.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tc.header != "" {
+				r.Header.Set("X-Forwarded-For", tc.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tc.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
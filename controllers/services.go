@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// Assim como Template, as interfaces abaixo desacoplam os controllers das
+// implementações dos serviços. Em produção são usados os serviços do pacote
+// models, que acessam o Postgres; nos testes as implementações em memória do
+// pacote models/memory.
+
+// Transactor executa fn em uma transação: as chamadas aos serviços feitas com
+// o ctx recebido por fn são confirmadas ou desfeitas juntas
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type UserService interface {
+	Create(ctx context.Context, email, password string) (*models.User, error)
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+	UpdatePassword(ctx context.Context, userID int, password string) error
+	ByID(ctx context.Context, id int) (*models.User, error)
+	ScheduleDeletion(ctx context.Context, userID int) (time.Time, error)
+	CancelDeletion(ctx context.Context, userID int) error
+}
+
+type SessionService interface {
+	Create(ctx context.Context, userID int) (*models.Session, error)
+	User(ctx context.Context, token string) (*models.User, error)
+	Delete(ctx context.Context, token string) error
+}
+
+type PasswordResetService interface {
+	Create(ctx context.Context, email string) (*models.PasswordReset, error)
+	Consume(ctx context.Context, token string) (*models.User, error)
+}
+
+type EmailService interface {
+	ForgotPassword(ctx context.Context, to, resetURL string) error
+	SecurityAlert(ctx context.Context, to string, alert models.SecurityAlert) error
+}
+
+type AuditService interface {
+	Record(ctx context.Context, event models.AuditEvent) error
+	ForUser(ctx context.Context, user *models.User, limit int) ([]models.AuditEvent, error)
+}
+
+type ExportService interface {
+	Write(ctx context.Context, w io.Writer, userID int) error
+}
+
+type InvitationService interface {
+	ByToken(ctx context.Context, token string) (*models.Invitation, error)
+	Consume(ctx context.Context, id int) error
+}
+
+type ImpersonationService interface {
+	User(ctx context.Context, adminID int, token string) (*models.User, error)
+}
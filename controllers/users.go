@@ -1,15 +1,20 @@
 package controllers
 
 import (
+	"bytes"
+	stdcontext "context"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/gorilla/csrf"
 	"github.com/vitoraalmeida/lenslocked/context"
 	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/metrics"
 	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/urls"
 )
 
 // desacopla o controller das views, injetando a instância
@@ -23,23 +28,81 @@ type Users struct {
 		ForgotPassword Template
 		CheckYourEmail Template
 		ResetPassword  Template
+		Activity       Template
+		DeleteAccount  Template
+		// página exibida após o pedido de remoção, com o usuário já deslogado
+		DeletionScheduled Template
 	}
-	UserService          *models.UserService
-	SessionService       *models.SessionService
-	PasswordResetService *models.PasswordResetService
-	EmailService         *models.EmailService
+	Errors               Errors
+	UserService          UserService
+	SessionService       SessionService
+	PasswordResetService PasswordResetService
+	EmailService         EmailService
+	URLs                 *urls.Builder
+	AuditService         AuditService
+	ExportService        ExportService
+	InvitationService    InvitationService
+	// Transactor agrupa as etapas do cadastro e da troca de senha
+	Transactor Transactor
+	// RegistrationMode define quem pode criar uma conta. Vazio equivale a
+	// models.RegistrationOpen
+	RegistrationMode string
+}
+
+// dados usados pelo template de cadastro
+type signupData struct {
+	CSRFField template.HTML
+	Email     string
+	Password  string
+	// Token do convite, quando o cadastro é feito a partir de um
+	Token  string
+	Closed bool
 }
 
 func (u Users) New(w http.ResponseWriter, r *http.Request) {
-	var data struct {
-		CSRFField template.HTML
-	}
+	var data signupData
 	data.CSRFField = csrf.TemplateField(r)
+	data.Email = r.FormValue("email")
+	data.Token = r.FormValue("token")
 	// adiciona no formulário um campo contendo o token CSRF que será enviado juntamente com os
 	// outros dados
+	_, err := u.checkRegistration(r, &data)
+	if err != nil {
+		u.Templates.New.Execute(w, r, data, err)
+		return
+	}
 	u.Templates.New.Execute(w, r, data)
 }
 
+// checkRegistration verifica se o cadastro é permitido no modo atual. No modo
+// por convite o email do formulário é substituído pelo email convidado e o
+// convite é retornado para que possa ser consumido após o cadastro
+func (u Users) checkRegistration(r *http.Request, data *signupData) (*models.Invitation, error) {
+	switch u.RegistrationMode {
+	case models.RegistrationClosed:
+		data.Closed = true
+		return nil, errors.Public(fmt.Errorf("registration closed"),
+			"Registration is currently closed.")
+	case models.RegistrationInviteOnly:
+		if data.Token == "" {
+			data.Closed = true
+			return nil, errors.Public(fmt.Errorf("missing invitation"),
+				"Registration is by invitation only.")
+		}
+		invitation, err := u.InvitationService.ByToken(r.Context(), data.Token)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidInvitation) {
+				data.Closed = true
+				err = errors.Public(err, "This invitation is invalid or has expired.")
+			}
+			return nil, err
+		}
+		data.Email = invitation.Email
+		return invitation, nil
+	}
+	return nil, nil
+}
+
 func (u Users) Create(w http.ResponseWriter, r *http.Request) {
 	/*
 		err := r.ParseForm()
@@ -50,15 +113,38 @@ func (u Users) Create(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "Email: ", r.PostForm.Get("email"))
 		fmt.Fprint(w, "Pass: ", r.PostForm.Get("password"))
 	*/
-	var data struct {
-		Email    string
-		Password string
-	}
+	var data signupData
 	// não checará erro pois se esses valores não estivem presentes, não há nada
 	// para fazer além de retornar erro
 	data.Email = r.FormValue("email")
 	data.Password = r.FormValue("password")
-	user, err := u.UserService.Create(data.Email, data.Password)
+	data.Token = r.FormValue("token")
+	invitation, err := u.checkRegistration(r, &data)
+	if err != nil {
+		u.Templates.New.Execute(w, r, data, err)
+		return
+	}
+	// a conta e o uso do convite são gravados juntos, assim um convite não é
+	// gasto sem que a conta seja criada, nem o contrário
+	var user *models.User
+	err = u.Transactor.InTx(r.Context(), func(ctx stdcontext.Context) error {
+		var err error
+		user, err = u.UserService.Create(ctx, data.Email, data.Password)
+		if err != nil {
+			return err
+		}
+		if invitation != nil {
+			err = u.InvitationService.Consume(ctx, invitation.ID)
+			if err != nil {
+				return err
+			}
+		}
+		event := auditEvent(r, models.AuditSignUp)
+		event.ActorID = user.ID
+		event.TargetID = user.ID
+		event.Email = user.Email
+		return writeAudit(ctx, u.AuditService, event)
+	})
 	if err != nil {
 		if errors.Is(err, models.ErrEmailTaken) {
 			err = errors.Public(err, "That email address is already associated with an account.")
@@ -66,13 +152,13 @@ func (u Users) Create(w http.ResponseWriter, r *http.Request) {
 		u.Templates.New.Execute(w, r, data, err)
 		return
 	}
-	session, err := u.SessionService.Create(user.ID)
+	session, err := u.SessionService.Create(r.Context(), user.ID)
 	if err != nil {
-		fmt.Println(err)
+		logError(r, err)
 		http.Redirect(w, r, "/signin", http.StatusFound)
 		return
 	}
-	setCookie(w, CookieSession, session.Token)
+	setCookie(w, r, CookieSession, session.Token)
 	// 301 (Moved) é para quando um recurso foi movido de url
 	// 302 (Found) consenso para quando vamos apenas redirecionar
 	http.Redirect(w, r, "/users/me", http.StatusFound)
@@ -90,19 +176,45 @@ func (u Users) ProcessSignIn(w http.ResponseWriter, r *http.Request) {
 	}
 	data.Email = r.FormValue("email")
 	data.Password = r.FormValue("password")
-	user, err := u.UserService.Authenticate(data.Email, data.Password)
+	user, err := u.UserService.Authenticate(r.Context(), data.Email, data.Password)
+	metrics.SignIn(err)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Invalid credentials", http.StatusBadRequest)
+		event := auditEvent(r, models.AuditSignInFailed)
+		event.Email = data.Email
+		recordAudit(r, u.AuditService, event)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			// mostra o formulário de novo, com o erro
+			status, _ := errorStatus(err)
+			u.Templates.SignIn.Execute(withStatus(w, status), r, nil, publicError(err))
+			return
+		}
+		u.Errors.Render(w, r, err)
 		return
 	}
-	session, err := u.SessionService.Create(user.ID)
+	var session *models.Session
+	err = u.Transactor.InTx(r.Context(), func(ctx stdcontext.Context) error {
+		var err error
+		session, err = u.SessionService.Create(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(r, models.AuditSignIn)
+		event.ActorID = user.ID
+		event.TargetID = user.ID
+		event.Email = user.Email
+		return writeAudit(ctx, u.AuditService, event)
+	})
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		u.Errors.Render(w, r, err)
+		return
+	}
+	setCookie(w, r, CookieSession, session.Token)
+	// a conta ainda pode ser recuperada durante o período de carência, então
+	// mostramos a opção de cancelar a remoção
+	if !user.DeletionScheduledAt.IsZero() {
+		http.Redirect(w, r, "/users/me/delete", http.StatusFound)
 		return
 	}
-	setCookie(w, CookieSession, session.Token)
 	http.Redirect(w, r, "/users/me", http.StatusFound)
 }
 
@@ -117,18 +229,39 @@ func (u Users) CurrentUser(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Current user: %s\n", user.Email)
 }
 
+// lista os eventos de segurança da conta do usuário atual
+func (u Users) Activity(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	var data struct {
+		Events []models.AuditEvent
+	}
+	var err error
+	data.Events, err = u.AuditService.ForUser(r.Context(), user, models.DefaultAuditLimit)
+	if err != nil {
+		u.Errors.Render(w, r, err)
+		return
+	}
+	u.Templates.Activity.Execute(w, r, data)
+}
+
 func (u Users) ProcessSignOut(w http.ResponseWriter, r *http.Request) {
 	token, err := readCookie(r, CookieSession)
 	if err != nil {
 		http.Redirect(w, r, "/signin", http.StatusFound)
 		return
 	}
-	err = u.SessionService.Delete(token)
+	err = u.SessionService.Delete(r.Context(), token)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		u.Errors.Render(w, r, err)
 		return
 	}
+	if user := context.User(r.Context()); user != nil {
+		event := auditEvent(r, models.AuditSignOut)
+		event.ActorID = user.ID
+		event.TargetID = user.ID
+		event.Email = user.Email
+		recordAudit(r, u.AuditService, event)
+	}
 	deleteCookie(w, CookieSession)
 	http.Redirect(w, r, "/signin", http.StatusFound)
 }
@@ -157,28 +290,38 @@ func (u Users) ProcessResetPassword(w http.ResponseWriter, r *http.Request) {
 	data.Token = r.FormValue("token")
 	data.Password = r.FormValue("password")
 
-	user, err := u.PasswordResetService.Consume(data.Token)
-	if err != nil {
-		fmt.Println()
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		return
-	}
-
-	err = u.UserService.UpdatePassword(user.ID, data.Password)
+	// o token só é gasto se a senha for de fato alterada
+	var user *models.User
+	err := u.Transactor.InTx(r.Context(), func(ctx stdcontext.Context) error {
+		var err error
+		user, err = u.PasswordResetService.Consume(ctx, data.Token)
+		if err != nil {
+			return err
+		}
+		err = u.UserService.UpdatePassword(ctx, user.ID, data.Password)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(r, models.AuditPasswordReset)
+		event.ActorID = user.ID
+		event.TargetID = user.ID
+		event.Email = user.Email
+		return writeAudit(ctx, u.AuditService, event)
+	})
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		u.Errors.Render(w, r, err)
 		return
 	}
+	u.securityAlert(r, user.Email, "Your password was changed.")
 	// Sign the user in now that they have reset their password.
 	// Any errors from this point onward should redirect to the sign in page.
-	session, err := u.SessionService.Create(user.ID)
+	session, err := u.SessionService.Create(r.Context(), user.ID)
 	if err != nil {
-		fmt.Println(err)
+		logError(r, err)
 		http.Redirect(w, r, "/signin", http.StatusFound)
 		return
 	}
-	setCookie(w, CookieSession, session.Token)
+	setCookie(w, r, CookieSession, session.Token)
 	http.Redirect(w, r, "/users/me", http.StatusFound)
 
 }
@@ -188,22 +331,28 @@ func (u Users) ProcessForgotPassword(w http.ResponseWriter, r *http.Request) {
 		Email string
 	}
 	data.Email = r.FormValue("email")
-	pwReset, err := u.PasswordResetService.Create(data.Email)
+	pwReset, err := u.PasswordResetService.Create(r.Context(), data.Email)
+	if errors.Is(err, models.ErrNotFound) {
+		// a resposta é a mesma de quando o email existe, senão a página
+		// revelaria quais emails têm conta
+		u.Templates.CheckYourEmail.Execute(w, r, data)
+		return
+	}
 	if err != nil {
-		// TODO: Handle other cases in the future. For instance,
-		// if a user doesn't exist with the email address.
-		fmt.Println(err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		u.Errors.Render(w, r, err)
 		return
 	}
+	event := auditEvent(r, models.AuditPasswordResetRequested)
+	event.TargetID = pwReset.UserID
+	event.Email = data.Email
+	recordAudit(r, u.AuditService, event)
 	vals := url.Values{
 		"token": {pwReset.Token},
 	}
-	// TODO: Make the URL here configurable
-	err = u.EmailService.ForgotPassword(data.Email, "http://localhost:3000/reset-pw?"+vals.Encode())
+	resetURL := u.URLs.URL("/reset-pw", vals)
+	err = u.EmailService.ForgotPassword(r.Context(), data.Email, resetURL)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		u.Errors.Render(w, r, err)
 		return
 	}
 
@@ -211,7 +360,10 @@ func (u Users) ProcessForgotPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 type UserMiddleware struct {
-	SessionService *models.SessionService
+	SessionService SessionService
+	// opcional; sem ele as personificações são ignoradas
+	ImpersonationService ImpersonationService
+	Errors               Errors
 }
 
 // middleware que recupera o token de sessão de um usuário caso esteja presente
@@ -224,19 +376,44 @@ func (umw UserMiddleware) SetUser(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := umw.SessionService.User(token)
+		user, err := umw.SessionService.User(r.Context(), token)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		ctx := r.Context()
+		// um admin com uma personificação ativa passa a navegar como o usuário
+		// alvo, mas mantemos o admin no contexto para exibir o aviso e bloquear
+		// ações sensíveis
+		if user.IsAdmin {
+			target := umw.impersonated(r, user)
+			if target != nil {
+				ctx = context.WithImpersonator(ctx, user)
+				user = target
+			}
+		}
 		ctx = context.WithUser(ctx, user)
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
 
+func (umw UserMiddleware) impersonated(r *http.Request, admin *models.User) *models.User {
+	if umw.ImpersonationService == nil {
+		return nil
+	}
+	token, err := readCookie(r, CookieImpersonation)
+	if err != nil {
+		return nil
+	}
+	target, err := umw.ImpersonationService.User(r.Context(), admin.ID, token)
+	if err != nil {
+		return nil
+	}
+	return target
+}
+
 // Assume que o middleware setUser foi usado e caso não haja usuário presente
 // redireciona para a pagina de login. Limita o uso de recursos para usuários
 // autenticados
@@ -251,3 +428,141 @@ func (umw UserMiddleware) RequireUser(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Assume que o middleware SetUser foi usado e só permite o acesso de admins.
+// Durante uma personificação o usuário no contexto é o alvo, então as páginas
+// administrativas ficam indisponíveis até que ela seja encerrada
+func (umw UserMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+		if !user.IsAdmin {
+			umw.Errors.Render(w, r, errors.Public(models.ErrForbidden, "You are not allowed to access this page."))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Bloqueia ações sensíveis (troca de senha, email, etc.) enquanto um admin
+// estiver personificando outro usuário
+func (umw UserMiddleware) ForbidImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if context.Impersonator(r.Context()) != nil {
+			umw.Errors.Render(w, r, errors.Public(models.ErrForbidden, "This action is not allowed while viewing as another user."))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Export envia um arquivo ZIP com todos os dados do usuário atual
+func (u Users) Export(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	// gera o arquivo num buffer para que possamos responder com um erro caso
+	// algo falhe no meio do caminho, assim como fazemos com os templates
+	var buf bytes.Buffer
+	err := u.ExportService.Write(r.Context(), &buf, user.ID)
+	if err != nil {
+		u.Errors.Render(w, r, err)
+		return
+	}
+	event := auditEvent(r, models.AuditDataExported)
+	event.ActorID = user.ID
+	event.TargetID = user.ID
+	event.Email = user.Email
+	recordAudit(r, u.AuditService, event)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="lenslocked-export-%d.zip"`, user.ID))
+	buf.WriteTo(w)
+}
+
+func (u Users) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	u.renderDeleteAccount(w, r)
+}
+
+func (u Users) renderDeleteAccount(w http.ResponseWriter, r *http.Request, errs ...error) {
+	// busca o usuário novamente pois o do contexto não possui a data de remoção
+	user, err := u.UserService.ByID(r.Context(), context.User(r.Context()).ID)
+	if err != nil {
+		u.Errors.Render(w, r, err)
+		return
+	}
+	var data struct {
+		DeletionScheduledAt time.Time
+	}
+	data.DeletionScheduledAt = user.DeletionScheduledAt
+	u.Templates.DeleteAccount.Execute(w, r, data, errs...)
+}
+
+// ProcessDeleteAccount agenda a remoção da conta após confirmar a senha. A
+// remoção definitiva acontece depois do período de carência
+func (u Users) ProcessDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	password := r.FormValue("password")
+	_, err := u.UserService.Authenticate(r.Context(), user.Email, password)
+	if err != nil {
+		u.renderDeleteAccount(w, r, errors.Public(err, "The password you entered is incorrect."))
+		return
+	}
+	deleteAt, err := u.UserService.ScheduleDeletion(r.Context(), user.ID)
+	if errors.Is(err, models.ErrLastOwner) {
+		u.renderDeleteAccount(w, r, errors.Public(err,
+			"You are the only owner of an organization with other members. Make someone else an owner first."))
+		return
+	}
+	if err != nil {
+		u.Errors.Render(w, r, err)
+		return
+	}
+	event := auditEvent(r, models.AuditDeletionRequested)
+	event.ActorID = user.ID
+	event.TargetID = user.ID
+	event.Email = user.Email
+	recordAudit(r, u.AuditService, event)
+	u.securityAlert(r, user.Email, fmt.Sprintf("Your account was scheduled to be deleted on %s.",
+		deleteAt.Format("January 2, 2006")))
+	// ScheduleDeletion já removeu a sessão, então o restante da página deve
+	// ser renderizado como para um visitante
+	deleteCookie(w, CookieSession)
+	r = r.WithContext(context.WithUser(r.Context(), nil))
+	var data struct {
+		DeletionScheduledAt time.Time
+	}
+	data.DeletionScheduledAt = deleteAt
+	u.Templates.DeletionScheduled.Execute(w, r, data)
+}
+
+func (u Users) CancelDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	err := u.UserService.CancelDeletion(r.Context(), user.ID)
+	if err != nil {
+		u.Errors.Render(w, r, err)
+		return
+	}
+	event := auditEvent(r, models.AuditDeletionCanceled)
+	event.ActorID = user.ID
+	event.TargetID = user.ID
+	event.Email = user.Email
+	recordAudit(r, u.AuditService, event)
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+// avisa o usuário por email sobre uma ação sensível feita na sua conta. Assim
+// como a auditoria, uma falha no envio não deve impedir a ação
+func (u Users) securityAlert(r *http.Request, to, summary string) {
+	err := u.EmailService.SecurityAlert(r.Context(), to, models.SecurityAlert{
+		Summary:   summary,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		logError(r, err)
+	}
+}
@@ -0,0 +1,465 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	lcontext "github.com/vitoraalmeida/lenslocked/context"
+	"github.com/vitoraalmeida/lenslocked/controllers"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/models/memory"
+	"github.com/vitoraalmeida/lenslocked/urls"
+)
+
+// garante que as implementações em memória continuam compatíveis com as
+// interfaces dos controllers
+var (
+	_ controllers.UserService          = (*memory.UserService)(nil)
+	_ controllers.SessionService       = (*memory.SessionService)(nil)
+	_ controllers.PasswordResetService = (*memory.PasswordResetService)(nil)
+	_ controllers.EmailService         = (*memory.EmailService)(nil)
+	_ controllers.AuditService         = (*memory.AuditService)(nil)
+	_ controllers.ExportService        = (*memory.ExportService)(nil)
+	_ controllers.InvitationService    = (*memory.InvitationService)(nil)
+	_ controllers.ImpersonationService = (*memory.ImpersonationService)(nil)
+)
+
+// fakeTemplate guarda os dados da última execução em vez de renderizar HTML
+type fakeTemplate struct {
+	mu   sync.Mutex
+	data interface{}
+	errs []error
+}
+
+func (t *fakeTemplate) Execute(w http.ResponseWriter, r *http.Request, data interface{}, errs ...error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = data
+	t.errs = errs
+	w.Write([]byte("rendered"))
+}
+
+func (t *fakeTemplate) lastErrs() []error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.errs
+}
+
+type testApp struct {
+	users          controllers.Users
+	umw            controllers.UserMiddleware
+	userService    *memory.UserService
+	sessionService *memory.SessionService
+	auditService   *memory.AuditService
+	emailService   *memory.EmailService
+	impersonations *memory.ImpersonationService
+	invitations    *memory.InvitationService
+	templates      map[string]*fakeTemplate
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	store := memory.NewStore()
+	app := &testApp{
+		userService:    &memory.UserService{Store: store},
+		sessionService: &memory.SessionService{Store: store},
+		auditService:   &memory.AuditService{Store: store},
+		emailService:   &memory.EmailService{},
+		impersonations: &memory.ImpersonationService{Store: store},
+		invitations:    &memory.InvitationService{Store: store},
+		templates:      make(map[string]*fakeTemplate),
+	}
+	urlBuilder, err := urls.New("https://lenslocked.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.users = controllers.Users{
+		UserService:          app.userService,
+		SessionService:       app.sessionService,
+		PasswordResetService: &memory.PasswordResetService{Store: store},
+		EmailService:         app.emailService,
+		URLs:                 urlBuilder,
+		AuditService:         app.auditService,
+		ExportService:        &memory.ExportService{Store: store},
+		InvitationService:    app.invitations,
+		Transactor:           &memory.Transactor{Store: store},
+		RegistrationMode:     models.RegistrationOpen,
+	}
+	tpl := func(name string) controllers.Template {
+		app.templates[name] = &fakeTemplate{}
+		return app.templates[name]
+	}
+	app.users.Templates.New = tpl("new")
+	app.users.Templates.SignIn = tpl("signin")
+	app.users.Templates.ForgotPassword = tpl("forgot-pw")
+	app.users.Templates.CheckYourEmail = tpl("check-your-email")
+	app.users.Templates.ResetPassword = tpl("reset-pw")
+	app.users.Templates.Activity = tpl("activity")
+	app.users.Templates.DeleteAccount = tpl("delete-account")
+	app.users.Templates.DeletionScheduled = tpl("deletion-scheduled")
+	app.umw = controllers.UserMiddleware{
+		SessionService:       app.sessionService,
+		ImpersonationService: app.impersonations,
+	}
+	return app
+}
+
+func (app *testApp) createUser(t *testing.T, email, password string) *models.User {
+	t.Helper()
+	user, err := app.userService.Create(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Create(%q) err = %v", email, err)
+	}
+	return user
+}
+
+// signIn cria uma sessão e retorna o cookie correspondente
+func (app *testApp) signIn(t *testing.T, user *models.User) *http.Cookie {
+	t.Helper()
+	session, err := app.sessionService.Create(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: controllers.CookieSession, Value: session.Token}
+}
+
+func postForm(target string, values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == controllers.CookieSession {
+			return c
+		}
+	}
+	t.Fatalf("response has no %s cookie", controllers.CookieSession)
+	return nil
+}
+
+func assertRedirect(t *testing.T, w *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if got := w.Header().Get("Location"); got != location {
+		t.Fatalf("Location = %q, want %q", got, location)
+	}
+}
+
+func TestUsersCreate(t *testing.T) {
+	app := newTestApp(t)
+	w := httptest.NewRecorder()
+	app.users.Create(w, postForm("/users", url.Values{
+		"email":    {"Jon@Example.com"},
+		"password": {"secret"},
+	}))
+
+	assertRedirect(t, w, "/users/me")
+	user, err := app.sessionService.User(context.Background(), sessionCookie(t, w).Value)
+	if err != nil {
+		t.Fatalf("session user err = %v", err)
+	}
+	if user.Email != "jon@example.com" {
+		t.Errorf("user email = %q, want %q", user.Email, "jon@example.com")
+	}
+	events := app.auditService.Events()
+	if len(events) != 1 || events[0].Action != models.AuditSignUp {
+		t.Errorf("audit events = %+v, want a single %s", events, models.AuditSignUp)
+	}
+}
+
+func TestUsersCreateEmailTaken(t *testing.T) {
+	app := newTestApp(t)
+	app.createUser(t, "jon@example.com", "secret")
+	w := httptest.NewRecorder()
+	app.users.Create(w, postForm("/users", url.Values{
+		"email":    {"jon@example.com"},
+		"password": {"other"},
+	}))
+
+	errs := app.templates["new"].lastErrs()
+	if len(errs) != 1 || !errors.Is(errs[0], models.ErrEmailTaken) {
+		t.Fatalf("template errs = %v, want %v", errs, models.ErrEmailTaken)
+	}
+}
+
+func TestUsersCreateRegistrationModes(t *testing.T) {
+	tests := map[string]struct {
+		mode string
+		// invite cria um convite e envia o token no formulário
+		invite  bool
+		wantErr bool
+	}{
+		"closed":                  {mode: models.RegistrationClosed, wantErr: true},
+		"invite only, no token":   {mode: models.RegistrationInviteOnly, wantErr: true},
+		"invite only, with token": {mode: models.RegistrationInviteOnly, invite: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.users.RegistrationMode = tc.mode
+			values := url.Values{
+				"email":    {"jon@example.com"},
+				"password": {"secret"},
+			}
+			if tc.invite {
+				invitation, err := app.invitations.Create(context.Background(), "invited@example.com", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				values.Set("token", invitation.Token)
+			}
+			w := httptest.NewRecorder()
+			app.users.Create(w, postForm("/users", values))
+
+			if tc.wantErr {
+				if errs := app.templates["new"].lastErrs(); len(errs) == 0 {
+					t.Fatal("expected the signup form to be rendered with an error")
+				}
+				return
+			}
+			assertRedirect(t, w, "/users/me")
+			// no modo por convite a conta usa o email convidado
+			_, err := app.userService.ByEmail(context.Background(), "invited@example.com")
+			if err != nil {
+				t.Fatalf("invited user not created: %v", err)
+			}
+		})
+	}
+}
+
+func TestUsersProcessSignIn(t *testing.T) {
+	app := newTestApp(t)
+	app.createUser(t, "jon@example.com", "secret")
+
+	t.Run("wrong password", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.users.ProcessSignIn(w, postForm("/signin", url.Values{
+			"email":    {"jon@example.com"},
+			"password": {"wrong"},
+		}))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		// o formulário é mostrado de novo com o erro
+		errs := app.templates["signin"].lastErrs()
+		if len(errs) != 1 || !errors.Is(errs[0], models.ErrInvalidCredentials) {
+			t.Errorf("template errs = %v, want %v", errs, models.ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("valid credentials", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.users.ProcessSignIn(w, postForm("/signin", url.Values{
+			"email":    {"JON@example.com"},
+			"password": {"secret"},
+		}))
+		assertRedirect(t, w, "/users/me")
+		sessionCookie(t, w)
+	})
+
+	t.Run("audit failure", func(t *testing.T) {
+		// sem o evento de auditoria o login não acontece
+		users := app.users
+		users.AuditService = failingAudit{app.auditService}
+		w := httptest.NewRecorder()
+		users.ProcessSignIn(w, postForm("/signin", url.Values{
+			"email":    {"jon@example.com"},
+			"password": {"secret"},
+		}))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+		if cookies := w.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("cookies = %v, want none", cookies)
+		}
+	})
+}
+
+// failingAudit falha ao gravar qualquer evento
+type failingAudit struct {
+	controllers.AuditService
+}
+
+func (failingAudit) Record(ctx context.Context, event models.AuditEvent) error {
+	return fmt.Errorf("record audit event: database is gone")
+}
+
+func TestUsersProcessSignOut(t *testing.T) {
+	app := newTestApp(t)
+	user := app.createUser(t, "jon@example.com", "secret")
+	cookie := app.signIn(t, user)
+
+	r := httptest.NewRequest(http.MethodPost, "/signout", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	app.umw.SetUser(http.HandlerFunc(app.users.ProcessSignOut)).ServeHTTP(w, r)
+
+	assertRedirect(t, w, "/signin")
+	_, err := app.sessionService.User(context.Background(), cookie.Value)
+	if err == nil {
+		t.Error("session still valid after signing out")
+	}
+}
+
+func TestUsersForgotAndResetPassword(t *testing.T) {
+	app := newTestApp(t)
+	app.createUser(t, "jon@example.com", "old-secret")
+
+	// o link enviado por email não pode vir do Host da requisição
+	r := postForm("/forgot-pw", url.Values{
+		"email": {"jon@example.com"},
+	})
+	r.Host = "attacker.example"
+	r.Header.Set("X-Forwarded-Host", "attacker.example")
+	w := httptest.NewRecorder()
+	app.users.ProcessForgotPassword(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("forgot password status = %d, want %d", w.Code, http.StatusOK)
+	}
+	emails := app.emailService.Emails()
+	if len(emails) != 1 || emails[0].Kind != "forgot-password" {
+		t.Fatalf("emails = %+v, want a single forgot-password email", emails)
+	}
+	resetURL, err := url.Parse(emails[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resetURL.Host != "lenslocked.test" || resetURL.Path != "/reset-pw" {
+		t.Errorf("reset URL = %s, want https://lenslocked.test/reset-pw", resetURL)
+	}
+
+	// o bcrypt recusa senhas com mais de 72 bytes. A falha ao trocar a senha
+	// não pode gastar o token
+	w = httptest.NewRecorder()
+	app.users.ProcessResetPassword(w, postForm("/reset-pw", url.Values{
+		"token":    {resetURL.Query().Get("token")},
+		"password": {strings.Repeat("x", 73)},
+	}))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("too long password: status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	w = httptest.NewRecorder()
+	app.users.ProcessResetPassword(w, postForm("/reset-pw", url.Values{
+		"token":    {resetURL.Query().Get("token")},
+		"password": {"new-secret"},
+	}))
+	assertRedirect(t, w, "/users/me")
+	_, err = app.userService.Authenticate(context.Background(), "jon@example.com", "new-secret")
+	if err != nil {
+		t.Errorf("Authenticate with the new password err = %v", err)
+	}
+	emails = app.emailService.Emails()
+	if last := emails[len(emails)-1]; last.Kind != "security-alert" {
+		t.Errorf("last email kind = %q, want security-alert", last.Kind)
+	}
+
+	// o token não pode ser usado duas vezes
+	w = httptest.NewRecorder()
+	app.users.ProcessResetPassword(w, postForm("/reset-pw", url.Values{
+		"token":    {resetURL.Query().Get("token")},
+		"password": {"again"},
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("reusing the token: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestUsersForgotPasswordUnknownEmail(t *testing.T) {
+	app := newTestApp(t)
+
+	w := httptest.NewRecorder()
+	app.users.ProcessForgotPassword(w, postForm("/forgot-pw", url.Values{
+		"email": {"nobody@example.com"},
+	}))
+	if w.Code != http.StatusOK || app.templates["check-your-email"].data == nil {
+		t.Errorf("status = %d, want the check-your-email page as for a known email", w.Code)
+	}
+	if emails := app.emailService.Emails(); len(emails) != 0 {
+		t.Errorf("emails = %+v, want none", emails)
+	}
+}
+
+func TestUserMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	admin := app.createUser(t, "admin@example.com", "secret")
+	err := app.userService.SetAdmin(context.Background(), admin.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.IsAdmin = true
+	target := app.createUser(t, "jon@example.com", "secret")
+	imp, err := app.impersonations.Start(context.Background(), admin, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// handler que responde com o email do usuário e do admin no contexto
+	var seenUser, seenImpersonator string
+	handler := app.umw.SetUser(app.umw.RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenUser = lcontext.User(r.Context()).Email
+		seenImpersonator = ""
+		if admin := lcontext.Impersonator(r.Context()); admin != nil {
+			seenImpersonator = admin.Email
+		}
+	})))
+
+	tests := map[string]struct {
+		cookies          []*http.Cookie
+		wantRedirect     bool
+		wantUser         string
+		wantImpersonator string
+	}{
+		"no session": {
+			wantRedirect: true,
+		},
+		"invalid session": {
+			cookies:      []*http.Cookie{{Name: controllers.CookieSession, Value: "invalid"}},
+			wantRedirect: true,
+		},
+		"signed in": {
+			cookies:  []*http.Cookie{app.signIn(t, target)},
+			wantUser: "jon@example.com",
+		},
+		"impersonating": {
+			cookies: []*http.Cookie{
+				app.signIn(t, admin),
+				{Name: controllers.CookieImpersonation, Value: imp.Token},
+			},
+			wantUser:         "jon@example.com",
+			wantImpersonator: "admin@example.com",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			seenUser, seenImpersonator = "", ""
+			r := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			for _, c := range tc.cookies {
+				r.AddCookie(c)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if tc.wantRedirect {
+				assertRedirect(t, w, "/signin")
+				return
+			}
+			if seenUser != tc.wantUser || seenImpersonator != tc.wantImpersonator {
+				t.Errorf("user = %q, impersonator = %q; want %q, %q",
+					seenUser, seenImpersonator, tc.wantUser, tc.wantImpersonator)
+			}
+		})
+	}
+}
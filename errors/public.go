@@ -25,3 +25,14 @@ func (pe publicError) Public() string {
 func (pe publicError) Unwrap() error {
 	return pe.err
 }
+
+// PublicMessage returns the message of the first error in err's chain that
+// was created with Public. ok is false when there is none, in which case
+// nothing about err should be shown to the user.
+func PublicMessage(err error) (msg string, ok bool) {
+	var pe interface{ Public() string }
+	if !As(err, &pe) {
+		return "", false
+	}
+	return pe.Public(), true
+}
@@ -0,0 +1,249 @@
+// Package jobs executa tarefas periódicas de manutenção, como a remoção de
+// tokens expirados, no próprio processo da aplicação.
+//
+// Todas as réplicas agendam todos os jobs, mas cada horário é executado por
+// apenas uma delas: a execução exige um lock por job (um advisory lock, no
+// Postgres) e é registrada em job_runs com uma restrição única em (job,
+// scheduled_at). O histórico dessa tabela pode ser consultado com
+// Runner.History.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/vitoraalmeida/lenslocked/metrics"
+	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultTimeout is the default time a single run of a job has to finish.
+const DefaultTimeout = 10 * time.Minute
+
+// Status de uma execução
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+var (
+	ErrUnknownJob = errors.New("jobs: unknown job")
+	// ErrSkipped indica que o horário já foi ou está sendo executado por
+	// outra réplica
+	ErrSkipped = errors.New("jobs: run skipped, another instance owns it")
+)
+
+type Job struct {
+	Name string
+	// Schedule usa o formato padrão do cron, com 5 campos
+	// (minuto hora dia mês dia-da-semana), ou descritores como @hourly. Os
+	// horários são em UTC
+	Schedule string
+	// Run retorna quantos registros foram afetados, o que fica no histórico
+	Run func(ctx context.Context) (int64, error)
+}
+
+// Run é uma entrada do histórico de execuções
+type Run struct {
+	ID          int
+	Job         string
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	// FinishedAt é zero enquanto o job está rodando
+	FinishedAt time.Time
+	Status     string
+	Affected   int64
+	Error      string
+}
+
+type Runner struct {
+	DB   *sql.DB
+	Jobs []Job
+	// Timeout defaults to DefaultTimeout
+	Timeout time.Duration
+}
+
+// Run agenda todos os jobs e bloqueia até ctx ser cancelado e as execuções em
+// andamento terminarem. Retorna um erro apenas se algum agendamento for
+// inválido, antes de executar qualquer job.
+func (r *Runner) Run(ctx context.Context) error {
+	schedules := make([]cron.Schedule, len(r.Jobs))
+	for i, job := range r.Jobs {
+		schedule, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("jobs: %s: %w", job.Name, err)
+		}
+		schedules[i] = schedule
+	}
+
+	var wg sync.WaitGroup
+	for i, job := range r.Jobs {
+		wg.Add(1)
+		go func(job Job, schedule cron.Schedule) {
+			defer wg.Done()
+			r.loop(ctx, job, schedule)
+		}(job, schedules[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// RunNow executa o job imediatamente, respeitando o lock, como se ele
+// estivesse agendado para o segundo atual
+func (r *Runner) RunNow(ctx context.Context, name string) (Run, error) {
+	for _, job := range r.Jobs {
+		if job.Name == name {
+			return r.execute(ctx, job, time.Now().Truncate(time.Second))
+		}
+	}
+	return Run{}, fmt.Errorf("%w: %q", ErrUnknownJob, name)
+}
+
+// History retorna as últimas execuções, da mais recente para a mais antiga
+func (r *Runner) History(ctx context.Context, limit int) ([]Run, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, job, scheduled_at, started_at, finished_at, status, affected, error
+		FROM job_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1;`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("job history: %w", err)
+	}
+	defer rows.Close()
+	var runs []Run
+	for rows.Next() {
+		var run Run
+		var finishedAt sql.NullTime
+		err = rows.Scan(&run.ID, &run.Job, &run.ScheduledAt, &run.StartedAt,
+			&finishedAt, &run.Status, &run.Affected, &run.Error)
+		if err != nil {
+			return nil, fmt.Errorf("job history: %w", err)
+		}
+		run.FinishedAt = finishedAt.Time
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("job history: %w", err)
+	}
+	return runs, nil
+}
+
+// DeleteHistoryBefore remove as execuções iniciadas antes de t
+func (r *Runner) DeleteHistoryBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		DELETE FROM job_runs
+		WHERE started_at < $1;`, t)
+	if err != nil {
+		return 0, fmt.Errorf("delete job history: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete job history: %w", err)
+	}
+	return n, nil
+}
+
+func (r *Runner) loop(ctx context.Context, job Job, schedule cron.Schedule) {
+	for {
+		// o próximo horário é calculado pelo relógio, em UTC, então é o mesmo
+		// em todas as réplicas
+		next := schedule.Next(time.Now().UTC())
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		run, err := r.execute(ctx, job, next)
+		switch {
+		case errors.Is(err, ErrSkipped):
+			slog.Debug("job skipped", "job", job.Name, "scheduled_at", next)
+		case err != nil:
+			slog.Error("running job", "job", job.Name, "error", err)
+		default:
+			slog.Info("job finished", "job", job.Name, "affected", run.Affected,
+				"duration", run.FinishedAt.Sub(run.StartedAt))
+		}
+	}
+}
+
+func (r *Runner) execute(ctx context.Context, job Job, scheduledAt time.Time) (Run, error) {
+	run := Run{
+		Job:         job.Name,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		Status:      StatusRunning,
+	}
+
+	// no Postgres é um advisory lock, que o banco libera sozinho se o
+	// processo morrer
+	unlock, locked, err := models.DialectOf(r.DB).TryLock(ctx, r.DB, lockKey(job.Name))
+	if err != nil {
+		return run, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if !locked {
+		return run, ErrSkipped
+	}
+	defer unlock()
+
+	// o lock evita execuções simultâneas; a restrição única evita que uma
+	// réplica atrasada repita um horário que outra já terminou
+	err = r.DB.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job, scheduled_at, started_at, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (job, scheduled_at) DO NOTHING
+		RETURNING id;`, run.Job, run.ScheduledAt, run.StartedAt, run.Status).Scan(&run.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, ErrSkipped
+	}
+	if err != nil {
+		return run, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	runCtx, span := tracing.Start(runCtx, "job "+job.Name, attribute.String("job.name", job.Name))
+	run.Affected, err = job.Run(runCtx)
+	tracing.End(span, err)
+	cancel()
+	metrics.JobRun(job.Name, err)
+
+	run.FinishedAt = time.Now()
+	run.Status = StatusSuccess
+	if err != nil {
+		run.Status = StatusFailure
+		run.Error = err.Error()
+	}
+	// registra o resultado mesmo que o servidor esteja encerrando
+	_, updateErr := r.DB.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE job_runs
+		SET finished_at = $2, status = $3, affected = $4, error = $5
+		WHERE id = $1;`, run.ID, run.FinishedAt, run.Status, run.Affected, run.Error)
+	if err != nil {
+		return run, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if updateErr != nil {
+		return run, fmt.Errorf("job %s: %w", job.Name, updateErr)
+	}
+	return run, nil
+}
+
+// lockKey converte o nome do job na chave numérica usada pelo lock
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("lenslocked.job." + name))
+	return int64(h.Sum64())
+}
@@ -1,88 +1,170 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/csrf"
-	"github.com/joho/godotenv"
+	"github.com/vitoraalmeida/lenslocked/config"
 	"github.com/vitoraalmeida/lenslocked/controllers"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/metrics"
 	"github.com/vitoraalmeida/lenslocked/migrations"
 	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/rand"
 	"github.com/vitoraalmeida/lenslocked/templates"
+	"github.com/vitoraalmeida/lenslocked/tlscert"
+	"github.com/vitoraalmeida/lenslocked/tracing"
+	"github.com/vitoraalmeida/lenslocked/urls"
 	"github.com/vitoraalmeida/lenslocked/views"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-type config struct {
-	PSQL models.PostgresConfig
-	SMTP models.SMTPConfig
-	CSRF struct {
-		Key    string
-		Secure bool
-	}
-	Server struct {
-		Address string
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
-func loadEnvConfig() (config, error) {
-	var cfg config
-	err := godotenv.Load()
+// run carrega a configuração e executa o subcomando. Sem subcomando o
+// servidor é iniciado, como antes.
+func run(args []string) error {
+	flags := flag.NewFlagSet("lenslocked", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path to a YAML or TOML config file (defaults to CONFIG_FILE)")
+	printConfig := flags.Bool("print-config", false, "print the effective config, with secrets redacted, and exit")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
 	if err != nil {
-		return cfg, err
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
 	}
-	// TODO: Read the PSQL values from an ENV variable
-	cfg.PSQL = models.DefaultPostgresConfig()
 
-	// TODO: SMTP
-	cfg.SMTP.Host = os.Getenv("SMTP_HOST")
-	portStr := os.Getenv("SMTP_PORT")
-	cfg.SMTP.Port, err = strconv.Atoi(portStr)
+	cfg, err := config.Load(*configFile)
 	if err != nil {
-		return cfg, err
+		return err
 	}
-	cfg.SMTP.Username = os.Getenv("SMTP_USERNAME")
-	cfg.SMTP.Password = os.Getenv("SMTP_PASSWORD")
-
-	// chave necessária para o gorilla csrf criar um token aleatório
-	// TODO: Read the CSRF values from an ENV variable
-	cfg.CSRF.Key = "gFvi45R4fy5xNBlnEeZtQbfAVCYEIAUX"
-	cfg.CSRF.Secure = false
-
-	// TODO: Read the server values from an ENV variable
-	cfg.Server.Address = ":3000"
+	if *printConfig {
+		return cfg.Print(os.Stdout)
+	}
+	logger := cfg.Logger(os.Stderr)
+	// usado pelo código que roda fora de uma requisição, como os workers
+	slog.SetDefault(logger)
 
-	return cfg, nil
+	args = flags.Args()
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		return serve(cfg, logger, args)
+	case "migrate":
+		return migrateCommand(cfg, args)
+	case "user":
+		return userCommand(cfg, args)
+	case "sessions":
+		return sessionsCommand(cfg, args)
+	case "jobs":
+		return jobsCommand(cfg, args)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
 }
 
-func main() {
-	cfg, err := loadEnvConfig()
+func serve(cfg config.Config, logger *slog.Logger, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	migrationMode := flags.String("migrate", cfg.Migrations.Mode, "what to do with pending migrations: auto, check or off")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	cfg.Migrations.Mode = *migrationMode
+	// config.Load só verifica o que todos os subcomandos usam
+	err = cfg.ValidateServe()
+	if err != nil {
+		return err
+	}
+	if cfg.CSRF.Key == "" {
+		// só acontece em development (Validate exige a chave em production).
+		// Os formulários abertos antes de reiniciar o servidor deixam de ser
+		// válidos, o que não é um problema durante o desenvolvimento
+		cfg.CSRF.Key, err = rand.String(24)
+		if err != nil {
+			return err
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Stdout:      os.Stdout,
+	})
 	if err != nil {
-		panic(err)
+		return err
 	}
+	// envia os spans pendentes; roda depois do fechamento do banco
+	defer shutdownTracing(context.Background())
 
 	// Setup the database
-	db, err := models.Open(cfg.PSQL)
+	db, err := openDB(cfg)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer db.Close()
-
-	// aplica migrations automaticamente utlizando arquivos
-	// de migration embutidos no binário, assim não precisamos
-	// copiar arquivos de migration para o local de produção
-	// manualmente
-	err = models.MigrateFS(db, migrations.FS, ".")
+	replica, err := openReplica(cfg)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if replica != nil {
+		defer replica.Close()
+	}
+
+	switch *migrationMode {
+	case models.MigrationModeAuto:
+		// aplica migrations automaticamente utlizando arquivos
+		// de migration embutidos no binário, assim não precisamos
+		// copiar arquivos de migration para o local de produção
+		// manualmente
+		err = models.MigrateFS(db, migrations.For(cfg.Database.Driver), ".")
+		if err != nil {
+			return err
+		}
+	case models.MigrationModeCheck:
+		// melhor não subir do que servir requisições com o schema antigo
+		_, err = models.CheckMigrations(context.Background(), db, migrations.For(cfg.Database.Driver), ".")
+		if err != nil {
+			return err
+		}
+	case models.MigrationModeOff:
+	default:
+		return fmt.Errorf("serve: unknown migration mode %q", *migrationMode)
 	}
 
 	// setup services
 	userService := models.UserService{
-		DB: db,
+		DB:      db,
+		Replica: replica,
 	}
 	sessionService := models.SessionService{
 		DB: db,
@@ -90,11 +172,78 @@ func main() {
 	pwResetService := models.PasswordResetService{
 		DB: db,
 	}
-	emailService := models.NewEmailService(cfg.SMTP)
+	impersonationService := models.ImpersonationService{
+		DB:      db,
+		Replica: replica,
+	}
+	auditService := models.AuditService{
+		DB:      db,
+		Replica: replica,
+	}
+	exportService := models.ExportService{
+		DB:      db,
+		Replica: replica,
+	}
+	invitationService := models.InvitationService{
+		DB: db,
+	}
+	organizationService := models.OrganizationService{
+		DB: db,
+	}
+	policy := models.Policy{
+		DB: db,
+	}
+	urlBuilder, err := urls.New(cfg.Server.BaseURL)
+	if err != nil {
+		return fmt.Errorf("BASE_URL: %w", err)
+	}
+	emailTemplates, err := models.ParseEmailTemplates(templates.FS, "email")
+	if err != nil {
+		return err
+	}
+	emailTemplates.URLs = urlBuilder
+	// com o transporte memory os emails ficam disponíveis em /dev/mailbox
+	var mailbox *models.MemoryMailer
+	var mailer models.Mailer
+	switch cfg.Mail.Transport {
+	case models.MailTransportFile:
+		mailer = &models.FileMailer{Dir: cfg.Mail.Dir}
+	case models.MailTransportMemory:
+		mailbox = &models.MemoryMailer{}
+		mailer = mailbox
+	default:
+		mailer = models.NewSMTPMailer(models.SMTPConfig(cfg.SMTP))
+	}
+	emailService := models.NewEmailService(mailer, emailTemplates)
+	defer emailService.Close()
+	// os emails são gravados no banco e enviados em segundo plano, assim uma
+	// falha no servidor SMTP não é percebida pelo usuário
+	emailOutbox := models.EmailOutbox{
+		DB: db,
+	}
+	emailService.Outbox = &emailOutbox
+	emailWorker := models.EmailWorker{
+		Outbox:       &emailOutbox,
+		EmailService: emailService,
+	}
 
 	// setup middlewares
+	lmw := controllers.LoggingMiddleware{
+		Logger: logger,
+	}
+	pmw := controllers.ProxyMiddleware{
+		Trust: cfg.Server.TrustProxy,
+	}
+	// página de erro compartilhada por todos os controllers
+	errorsC := controllers.Errors{
+		Page: views.Must(views.ParseFS(
+			templates.FS, "error.gohtml", "tailwind.gohtml",
+		)),
+	}
 	umw := controllers.UserMiddleware{
-		SessionService: &sessionService,
+		SessionService:       &sessionService,
+		ImpersonationService: &impersonationService,
+		Errors:               errorsC,
 	}
 
 	csrfMw := csrf.Protect(
@@ -108,6 +257,13 @@ func main() {
 		SessionService:       &sessionService,
 		PasswordResetService: &pwResetService,
 		EmailService:         emailService,
+		URLs:                 urlBuilder,
+		AuditService:         &auditService,
+		ExportService:        &exportService,
+		InvitationService:    &invitationService,
+		Transactor:           &models.Transactor{DB: db},
+		RegistrationMode:     cfg.Registration.Mode,
+		Errors:               errorsC,
 	}
 
 	usersC.Templates.New = views.Must(views.ParseFS(
@@ -128,12 +284,99 @@ func main() {
 		templates.FS,
 		"reset-pw.gohtml", "tailwind.gohtml",
 	))
+	usersC.Templates.Activity = views.Must(views.ParseFS(
+		templates.FS,
+		"activity.gohtml", "tailwind.gohtml",
+	))
+	usersC.Templates.DeleteAccount = views.Must(views.ParseFS(
+		templates.FS,
+		"delete-account.gohtml", "tailwind.gohtml",
+	))
+	usersC.Templates.DeletionScheduled = views.Must(views.ParseFS(
+		templates.FS,
+		"deletion-scheduled.gohtml", "tailwind.gohtml",
+	))
+
+	invitationsC := controllers.Invitations{
+		InvitationService: &invitationService,
+		EmailService:      emailService,
+		URLs:              urlBuilder,
+		AuditService:      &auditService,
+		RegistrationMode:  cfg.Registration.Mode,
+		Errors:            errorsC,
+	}
+	invitationsC.Templates.New = views.Must(views.ParseFS(
+		templates.FS,
+		"invitations.gohtml", "tailwind.gohtml",
+	))
+
+	organizationsC := controllers.Organizations{
+		OrganizationService: &organizationService,
+		Policy:              &policy,
+		EmailService:        emailService,
+		URLs:                urlBuilder,
+		Errors:              errorsC,
+	}
+	organizationsC.Templates.Index = views.Must(views.ParseFS(
+		templates.FS,
+		"organizations.gohtml", "tailwind.gohtml",
+	))
+	organizationsC.Templates.Show = views.Must(views.ParseFS(
+		templates.FS,
+		"organization.gohtml", "tailwind.gohtml",
+	))
+	organizationsC.Templates.Join = views.Must(views.ParseFS(
+		templates.FS,
+		"organization-join.gohtml", "tailwind.gohtml",
+	))
+
+	adminC := controllers.Admin{
+		UserService:          &userService,
+		ImpersonationService: &impersonationService,
+		AuditService:         &auditService,
+		EmailOutbox:          &emailOutbox,
+		Errors:               errorsC,
+		Transactor:           &models.Transactor{DB: db},
+	}
+	adminC.Templates.Users = views.Must(views.ParseFS(
+		templates.FS,
+		"admin-users.gohtml", "tailwind.gohtml",
+	))
+	adminC.Templates.Audit = views.Must(views.ParseFS(
+		templates.FS,
+		"admin-audit.gohtml", "tailwind.gohtml",
+	))
+	adminC.Templates.Emails = views.Must(views.ParseFS(
+		templates.FS,
+		"admin-emails.gohtml", "tailwind.gohtml",
+	))
+
+	devC := controllers.Dev{
+		EmailService: emailService,
+		MemoryMailer: mailbox,
+		Errors:       errorsC,
+	}
+	devC.Templates.Emails = views.Must(views.ParseFS(
+		templates.FS,
+		"dev-emails.gohtml", "tailwind.gohtml",
+	))
+	devC.Templates.Mailbox = views.Must(views.ParseFS(
+		templates.FS,
+		"dev-mailbox.gohtml", "tailwind.gohtml",
+	))
 
 	// setup router
 	r := chi.NewRouter()
 	// utilzia a proteção csrf e o middleware de recuperação de usuário na requisição em todas as requisições. Primeiro aplica a recuperação do usuário no contexto e depois o csrf
 	// o middleware que é registrado primeiro é o middleware que englobará
 	// todos os restantes
+	// o request ID e o access log vêm antes de tudo para que também cubram
+	// as requisições rejeitadas pelo csrf
+	r.Use(pmw.RealIP)
+	r.Use(lmw.RequestID)
+	r.Use(lmw.AccessLog)
+	r.Use(metrics.Middleware)
+	r.Use(tracing.RouteMiddleware)
 	r.Use(csrfMw)
 	r.Use(umw.SetUser)
 	tpl := views.Must(views.ParseFS(templates.FS, "home.gohtml", "tailwind.gohtml"))
@@ -147,28 +390,258 @@ func main() {
 	r.Get("/signin", usersC.SignIn)
 	r.Post("/signin", usersC.ProcessSignIn)
 	r.Post("/users", usersC.Create)
-	r.Post("/signout", usersC.ProcessSignOut)
+	r.With(umw.ForbidImpersonation).Post("/signout", usersC.ProcessSignOut)
 	// cria um prefixo que possui rotas específicas em si e midlewares que tem
 	// de ser usados para acessar determinados recursos
 	r.Route("/users/me", func(r chi.Router) {
 		r.Use(umw.RequireUser)
 		r.Get("/", usersC.CurrentUser)
+		r.Get("/activity", usersC.Activity)
+		r.Get("/invitations", invitationsC.New)
+		r.With(umw.ForbidImpersonation).Post("/invitations", invitationsC.Create)
+		// exportar e remover a conta não são permitidos durante uma
+		// personificação
+		r.Group(func(r chi.Router) {
+			r.Use(umw.ForbidImpersonation)
+			r.Get("/export", usersC.Export)
+			r.Get("/delete", usersC.DeleteAccount)
+			r.Post("/delete", usersC.ProcessDeleteAccount)
+			r.Post("/delete/cancel", usersC.CancelDeleteAccount)
+		})
 	})
 	r.Get("/forgot-pw", usersC.ForgotPassword)
-	r.Post("/forgot-pw", usersC.ProcessForgotPassword)
 	r.Get("/reset-pw", usersC.ResetPassword)
-	r.Post("/reset-pw", usersC.ProcessResetPassword)
+	// alterações de senha (e futuramente de email) não podem ser feitas por
+	// um admin que está vendo o sistema como outro usuário
+	r.Group(func(r chi.Router) {
+		r.Use(umw.ForbidImpersonation)
+		r.Post("/forgot-pw", usersC.ProcessForgotPassword)
+		r.Post("/reset-pw", usersC.ProcessResetPassword)
+	})
+	r.Route("/organizations", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", organizationsC.Index)
+		r.Post("/", organizationsC.Create)
+		r.Get("/join", organizationsC.Join)
+		r.Post("/join", organizationsC.ProcessJoin)
+		r.Get("/{id}", organizationsC.Show)
+		r.Post("/{id}/invitations", organizationsC.Invite)
+		r.Post("/{id}/members/{userID}/role", organizationsC.SetRole)
+		r.Post("/{id}/members/{userID}/delete", organizationsC.RemoveMember)
+	})
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(umw.RequireAdmin)
+		r.Get("/users", adminC.Users)
+		r.Get("/audit", adminC.Audit)
+		r.Get("/emails", adminC.DeadLetters)
+		r.Post("/users/{id}/impersonate", adminC.StartImpersonation)
+	})
+	r.Post("/impersonation/stop", adminC.StopImpersonation)
+	if cfg.Env == config.EnvDevelopment {
+		r.Get("/dev/emails", devC.Emails)
+		r.Get("/dev/emails/{name}", devC.Email)
+		if mailbox != nil {
+			r.Get("/dev/mailbox", devC.Mailbox)
+			r.Get("/dev/mailbox/{id}", devC.MailboxEmail)
+		}
+	}
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Page not found", http.StatusNotFound)
+		errorsC.Render(w, r, errors.Public(models.ErrNotFound, "Page not found."))
 	})
 
+	// as probes ficam num router à parte, fora dos middlewares de sessão e
+	// csrf (e dos access logs, já que são chamadas a cada poucos segundos)
+	healthC := controllers.Health{
+		Checks: []controllers.HealthCheck{
+			{Name: "database", Check: db.PingContext},
+			{Name: "migrations", Check: func(ctx context.Context) error {
+				_, err := models.CheckMigrations(ctx, db, migrations.For(cfg.Database.Driver), ".")
+				return err
+			}},
+			// o banco é o único armazenamento da aplicação; sem escrita nem o
+			// login funciona
+			{Name: "storage", Check: func(ctx context.Context) error {
+				return models.DialectOf(db).CheckWritable(ctx, db)
+			}},
+			{Name: "mail", Check: emailService.Check},
+		},
+	}
+	if replica != nil {
+		healthC.Checks = append(healthC.Checks,
+			controllers.HealthCheck{Name: "replica", Check: replica.PingContext})
+	}
+	root := chi.NewRouter()
+	root.Get("/healthz", healthC.Live)
+	root.Get("/readyz", healthC.Ready)
+	root.Mount("/", r)
+
+	// o contexto é cancelado no primeiro SIGINT/SIGTERM; um segundo sinal
+	// encerra o processo imediatamente
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// os workers usam um contexto próprio para só serem parados depois que as
+	// requisições em andamento terminarem, já que elas ainda podem enfileirar
+	// emails
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	if cfg.Jobs.Enabled {
+		runner := maintenanceJobs(cfg, db)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			err := runner.Run(workerCtx)
+			if err != nil {
+				logger.Error("starting maintenance jobs", "error", err)
+			}
+		}()
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		emailWorker.Run(workerCtx)
+	}()
+
 	// Start the server
-	fmt.Printf("Starting the server on %s...\n", cfg.Server.Address)
-	err = http.ListenAndServe(cfg.Server.Address, r)
-	if err != nil {
-		panic(err)
+	// o otelhttp cria o span de cada requisição (exceto das probes), que é
+	// renomeado com a rota do chi pelo tracing.RouteMiddleware
+	var handler http.Handler = otelhttp.NewHandler(root, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+		}))
+	if cfg.TLSEnabled() && cfg.TLS.HSTSMaxAge > 0 {
+		handler = hstsMiddleware(cfg.TLS.HSTSMaxAge)(handler)
+	}
+	server := newServer(cfg, cfg.Server.Address, handler)
+	// servers contém o servidor principal e, se configurado, o listener que
+	// redireciona HTTP para HTTPS
+	servers := []*http.Server{server}
+	serverErr := make(chan error, 3)
+	if cfg.Metrics.Address != "" {
+		err = metrics.RegisterDB(db, "lenslocked")
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer := newServer(cfg, cfg.Metrics.Address, mux)
+		servers = append(servers, metricsServer)
+		go func() {
+			logger.Info("serving metrics", "address", cfg.Metrics.Address)
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+	}
+	if cfg.TLSEnabled() {
+		minVersion, err := cfg.TLSMinVersion()
+		if err != nil {
+			return err
+		}
+		certs, err := tlscert.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			certs.Watch(workerCtx, cfg.TLS.ReloadInterval)
+		}()
+		server.TLSConfig = &tls.Config{
+			MinVersion:     minVersion,
+			GetCertificate: certs.GetCertificate,
+		}
+		if cfg.TLS.RedirectAddress != "" {
+			redirect := newServer(cfg, cfg.TLS.RedirectAddress, redirectToHTTPS(cfg.Server.Address))
+			servers = append(servers, redirect)
+			go func() {
+				logger.Info("redirecting HTTP to HTTPS", "address", cfg.TLS.RedirectAddress)
+				serverErr <- redirect.ListenAndServe()
+			}()
+		}
+		go func() {
+			logger.Info("starting the server", "address", cfg.Server.Address, "tls", true)
+			// o certificado vem do GetCertificate
+			serverErr <- server.ListenAndServeTLS("", "")
+		}()
+	} else {
+		go func() {
+			logger.Info("starting the server", "address", cfg.Server.Address, "tls", false)
+			serverErr <- server.ListenAndServe()
+		}()
 	}
 
+	select {
+	case err := <-serverErr:
+		// o servidor nem chegou a subir, por exemplo porque a porta está em uso
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	logger.Info("shutting down, waiting for in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			logger.Error("shutdown", "error", err)
+			server.Close()
+		}
+	}
+	stopWorkers()
+	workers.Wait()
+	// os defers fecham o EmailService e o banco depois daqui
+	logger.Info("server stopped")
+	return nil
+}
+
+func newServer(cfg config.Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+}
+
+// hstsMiddleware instrui o browser a só acessar o site por HTTPS pelo tempo
+// de maxAge
+func hstsMiddleware(maxAge time.Duration) func(http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d; includeSubDomains", int(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// redirectToHTTPS redireciona para o mesmo host e path no endereço HTTPS
+// httpsAddr. A porta só aparece na URL quando não é a 443
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, err := net.SplitHostPort(httpsAddr)
+	if err != nil || port == "443" {
+		port = ""
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
 }
 
 // o middleware csrfMw exige que seja passado um token nas requisições que garantem que a requisição para o servidor
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/config"
+	"github.com/vitoraalmeida/lenslocked/jobs"
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// maintenanceJobs monta o Runner com os jobs de manutenção. É usado pelo
+// servidor e pelo subcomando jobs, assim "jobs run" executa exatamente o
+// mesmo código do agendamento. Os minutos são diferentes para que os jobs não
+// concorram pelo banco no mesmo instante.
+func maintenanceJobs(cfg config.Config, db *sql.DB) *jobs.Runner {
+	userService := models.UserService{
+		DB: db,
+	}
+	sessionService := models.SessionService{
+		DB: db,
+	}
+	pwResetService := models.PasswordResetService{
+		DB: db,
+	}
+	impersonationService := models.ImpersonationService{
+		DB: db,
+	}
+	invitationService := models.InvitationService{
+		DB: db,
+	}
+	organizationService := models.OrganizationService{
+		DB: db,
+	}
+	auditService := models.AuditService{
+		DB: db,
+	}
+	emailOutbox := models.EmailOutbox{
+		DB: db,
+	}
+
+	runner := &jobs.Runner{
+		DB: db,
+	}
+	runner.Jobs = []jobs.Job{
+		{
+			Name:     "purge-expired-tokens",
+			Schedule: "*/15 * * * *",
+			Run: func(ctx context.Context) (int64, error) {
+				var total int64
+				for _, purge := range []func(context.Context) (int64, error){
+					pwResetService.DeleteExpired,
+					impersonationService.DeleteExpired,
+					invitationService.DeleteExpired,
+					organizationService.DeleteExpiredInvitations,
+				} {
+					n, err := purge(ctx)
+					total += n
+					if err != nil {
+						return total, err
+					}
+				}
+				return total, nil
+			},
+		},
+		{
+			Name:     "purge-old-sessions",
+			Schedule: "5 * * * *",
+			Run: func(ctx context.Context) (int64, error) {
+				return sessionService.DeleteOlderThan(ctx, cfg.Jobs.SessionMaxAge)
+			},
+		},
+		{
+			// remove definitivamente as contas cujo período de carência terminou
+			Name:     "purge-deleted-accounts",
+			Schedule: "10 * * * *",
+			Run: func(ctx context.Context) (int64, error) {
+				n, err := userService.DeleteScheduled(ctx)
+				return int64(n), err
+			},
+		},
+		{
+			Name:     "purge-old-audit-events",
+			Schedule: "30 3 * * *",
+			Run: func(ctx context.Context) (int64, error) {
+				return auditService.DeleteBefore(ctx, time.Now().Add(-cfg.Jobs.AuditRetention))
+			},
+		},
+		{
+			Name:     "purge-job-history",
+			Schedule: "45 3 * * *",
+			Run: func(ctx context.Context) (int64, error) {
+				return runner.DeleteHistoryBefore(ctx, time.Now().Add(-cfg.Jobs.HistoryRetention))
+			},
+		},
+		{
+			// o conteúdo já foi apagado no envio; aqui sai o resto do registro
+			Name:     "purge-sent-emails",
+			Schedule: "0 4 * * *",
+			Run: func(ctx context.Context) (int64, error) {
+				return emailOutbox.DeleteBefore(ctx, time.Now().Add(-cfg.Jobs.EmailRetention))
+			},
+		},
+	}
+	return runner
+}
+
+func jobsCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("jobs: missing subcommand (list, history or run)")
+	}
+	sub, args := args[0], args[1:]
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	runner := maintenanceJobs(cfg, db)
+	ctx := context.Background()
+
+	switch sub {
+	case "list":
+		for _, job := range runner.Jobs {
+			fmt.Printf("%-24s %s\n", job.Name, job.Schedule)
+		}
+	case "history":
+		runs, err := runner.History(ctx, 50)
+		if err != nil {
+			return err
+		}
+		for _, run := range runs {
+			fmt.Printf("%s  %-24s %-8s affected=%d %s\n",
+				run.StartedAt.Format(time.RFC3339), run.Job, run.Status, run.Affected, run.Error)
+		}
+	case "run":
+		if len(args) != 1 {
+			return errors.New("jobs run: expected a job name")
+		}
+		run, err := runner.RunNow(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s finished, affected=%d\n", run.Job, run.Affected)
+	default:
+		return fmt.Errorf("jobs: unknown subcommand %q", sub)
+	}
+	return nil
+}
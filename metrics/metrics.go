@@ -0,0 +1,134 @@
+// Package metrics expõe as métricas da aplicação no formato do Prometheus.
+//
+// As métricas ficam num registry próprio, servido por Handler num listener
+// separado, para que não fiquem expostas junto com o site.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lenslocked"
+
+// resultados usados nos contadores de emails, de sign in e de jobs
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	templateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "template_render_duration_seconds",
+		Help:      "Time spent executing HTML templates.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"template"})
+	emailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Emails handed to the mail transport, by result.",
+	}, []string{"result"})
+	signIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sign_ins_total",
+		Help:      "Sign in attempts by result.",
+	}, []string{"result"})
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Background job runs by job and result.",
+	}, []string{"job", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		templateDuration,
+		emailsSent,
+		signIns,
+		jobRuns,
+	)
+}
+
+// Handler serve as métricas registradas
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB expõe as estatísticas do pool de conexões (sql.DB.Stats)
+func RegisterDB(db *sql.DB, name string) error {
+	return registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware conta as requisições e mede a latência usando o padrão da rota
+// do chi (/organizations/{id}) em vez do path, assim cada ID não vira uma
+// série nova. Requisições que não casam com nenhuma rota usam "unmatched".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		route := "unmatched"
+		// o padrão só é conhecido depois que o router processou a requisição
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+func ObserveTemplate(name string, d time.Duration) {
+	templateDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// EmailSent registra o resultado de uma entrega de email
+func EmailSent(err error) {
+	emailsSent.WithLabelValues(result(err)).Inc()
+}
+
+// SignIn registra o resultado de uma tentativa de sign in
+func SignIn(err error) {
+	signIns.WithLabelValues(result(err)).Inc()
+}
+
+// JobRun registra o resultado de uma execução de um job periódico
+func JobRun(job string, err error) {
+	jobRuns.WithLabelValues(job, result(err)).Inc()
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- sessão especial criada quando um admin visualiza o sistema como outro usuário.
+-- não reutiliza a tabela sessions pois ela só permite uma sessão por usuário e
+-- isso derrubaria a sessão real do usuário alvo
+CREATE TABLE impersonation_sessions (
+    id SERIAL PRIMARY KEY,
+    admin_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- registro permanente de inícios e fins de personificação
+CREATE TABLE impersonation_audit (
+    id SERIAL PRIMARY KEY,
+    admin_id INT REFERENCES users (id) ON DELETE SET NULL,
+    user_id INT REFERENCES users (id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE impersonation_audit;
+
+DROP TABLE impersonation_sessions;
+
+ALTER TABLE users
+    DROP COLUMN is_admin;
+
+-- +goose StatementEnd
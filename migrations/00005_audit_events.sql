@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- actor_id e target_id ficam nulos quando não há um usuário conhecido, como
+-- numa tentativa de login com um email inexistente. O email envolvido na ação
+-- é guardado separadamente para esses casos
+CREATE TABLE audit_events (
+    id SERIAL PRIMARY KEY,
+    actor_id INT REFERENCES users (id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_id INT REFERENCES users (id) ON DELETE SET NULL,
+    email TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id);
+
+CREATE INDEX audit_events_target_id_idx ON audit_events (target_id);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- quando preenchido, a conta será removida definitivamente após essa data
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN deletion_scheduled_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- emails aguardando envio pelo worker. Após o número máximo de tentativas o
+-- status passa a ser 'dead' e o email fica guardado para análise
+CREATE TABLE email_outbox (
+    id SERIAL PRIMARY KEY,
+    sender TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    plaintext TEXT NOT NULL,
+    html TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX email_outbox_pending_idx ON email_outbox (next_attempt_at)
+WHERE
+    status = 'pending';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE email_outbox;
+
+-- +goose StatementEnd
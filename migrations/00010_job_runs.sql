@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- sessões existentes recebem a data da migration e expiram normalmente
+ALTER TABLE sessions
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- histórico das execuções dos jobs periódicos. A restrição única em (job,
+-- scheduled_at) garante que cada horário agendado seja executado por uma
+-- única réplica
+CREATE TABLE job_runs (
+    id SERIAL PRIMARY KEY,
+    job TEXT NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    status TEXT NOT NULL DEFAULT 'running',
+    affected BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    UNIQUE (job, scheduled_at)
+);
+
+CREATE INDEX job_runs_started_at_idx ON job_runs (started_at);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE job_runs;
+
+ALTER TABLE sessions
+    DROP COLUMN created_at;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a trilha das personificações passa a ficar só em audit_events, gravada na
+-- mesma transação que inicia ou encerra a personificação. Desde a 00005 os
+-- dois registros eram gravados; copia apenas os anteriores a isso
+INSERT INTO audit_events (actor_id, action, target_id, email, ip_address, user_agent, created_at)
+SELECT admin_id,
+    CASE action
+        WHEN 'start' THEN 'admin.impersonation_started'
+        ELSE 'admin.impersonation_stopped'
+    END,
+    user_id, '', '', '', created_at
+FROM impersonation_audit
+WHERE NOT EXISTS (
+    SELECT 1 FROM audit_events
+    WHERE audit_events.action IN ('admin.impersonation_started', 'admin.impersonation_stopped')
+        AND audit_events.created_at <= impersonation_audit.created_at
+);
+
+DROP TABLE impersonation_audit;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+-- os eventos continuam em audit_events
+CREATE TABLE impersonation_audit (
+    id SERIAL PRIMARY KEY,
+    admin_id INT REFERENCES users (id) ON DELETE SET NULL,
+    user_id INT REFERENCES users (id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose StatementEnd
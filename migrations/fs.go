@@ -1,6 +1,25 @@
 package migrations
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
+)
 
-//go:embed *.sql
+// FS tem as migrations do Postgres na raiz e as do SQLite em sqlite/. Toda
+// migration nova precisa existir nos dois diretórios, com a mesma versão.
+//
+//go:embed *.sql sqlite/*.sql
 var FS embed.FS
+
+// For retorna as migrations do banco informado, um dos models.Driver*
+func For(driver string) fs.FS {
+	if driver == "sqlite" {
+		sub, err := fs.Sub(FS, "sqlite")
+		if err != nil {
+			// o diretório é embutido junto com o binário
+			panic(err)
+		}
+		return sub
+	}
+	return FS
+}
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- um convite por email. Convidar o mesmo email novamente gera um novo token
+CREATE TABLE invitations (
+    id INTEGER PRIMARY KEY,
+    email TEXT UNIQUE NOT NULL,
+    invited_by INT REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE invitations;
+
+-- +goose StatementEnd
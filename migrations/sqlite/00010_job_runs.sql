@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- sessões existentes recebem a data da migration e expiram normalmente. O
+-- SQLite não aceita um default que não seja constante no ADD COLUMN, então a
+-- data é preenchida logo em seguida
+ALTER TABLE sessions
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+UPDATE sessions
+SET created_at = CURRENT_TIMESTAMP;
+
+-- histórico das execuções dos jobs periódicos. A restrição única em (job,
+-- scheduled_at) garante que cada horário agendado seja executado por uma
+-- única réplica
+CREATE TABLE job_runs (
+    id INTEGER PRIMARY KEY,
+    job TEXT NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'running',
+    affected BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    UNIQUE (job, scheduled_at)
+);
+
+CREATE INDEX job_runs_started_at_idx ON job_runs (started_at);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE job_runs;
+
+ALTER TABLE sessions
+    DROP COLUMN created_at;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- o conteúdo dos emails enviados ou desistidos passa a ser apagado, pois os
+-- links de reset e de convite contêm tokens válidos. Limpa o que já estava
+-- guardado
+UPDATE email_outbox
+SET
+    plaintext = '',
+    html = ''
+WHERE
+    status <> 'pending';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+-- o conteúdo apagado não pode ser recuperado
+SELECT
+    1;
+
+-- +goose StatementEnd
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ações registradas na trilha de auditoria
+const (
+	AuditSignUp                 = "user.signup"
+	AuditSignIn                 = "user.signin"
+	AuditSignInFailed           = "user.signin_failed"
+	AuditSignOut                = "user.signout"
+	AuditPasswordResetRequested = "user.password_reset_requested"
+	AuditPasswordReset          = "user.password_reset"
+	AuditInvitationSent         = "user.invitation_sent"
+	AuditDataExported           = "user.data_exported"
+	AuditDeletionRequested      = "user.deletion_requested"
+	AuditDeletionCanceled       = "user.deletion_canceled"
+	AuditImpersonationStarted   = "admin.impersonation_started"
+	AuditImpersonationStopped   = "admin.impersonation_stopped"
+)
+
+// DefaultAuditLimit is the number of events returned when a query doesn't
+// set its own limit.
+const DefaultAuditLimit = 50
+
+type AuditEvent struct {
+	ID int
+	// ActorID é o usuário que executou a ação e TargetID o usuário afetado por
+	// ela. Zero significa que não há usuário conhecido
+	ActorID  int
+	Action   string
+	TargetID int
+	// Email envolvido na ação, útil quando não há usuário, como numa tentativa
+	// de login com um email que não existe
+	Email     string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+
+	// preenchidos apenas nas consultas
+	ActorEmail  string
+	TargetEmail string
+}
+
+// AuditFilter restringe os eventos retornados por AuditService.List. Campos
+// com o valor zero são ignorados.
+type AuditFilter struct {
+	Action string
+	// UserID busca eventos em que o usuário é o ator ou o alvo
+	UserID int
+	// Email busca eventos em que o email do ator, do alvo ou o email
+	// registrado contém o valor informado
+	Email string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+type AuditService struct {
+	DB *sql.DB
+	// Replica, quando definida, recebe as consultas que toleram dados alguns
+	// segundos atrasados: ForUser e List
+	Replica *sql.DB
+}
+
+func (as *AuditService) Record(ctx context.Context, event AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	_, err := conn(ctx, as.DB).ExecContext(ctx, `
+		INSERT INTO audit_events (actor_id, action, target_id, email, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		nullID(event.ActorID), event.Action, nullID(event.TargetID),
+		strings.ToLower(event.Email), event.IPAddress, event.UserAgent, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("record audit event: %w", err)
+	}
+	return nil
+}
+
+// ForUser retorna os eventos mais recentes relacionados ao usuário, seja como
+// ator, alvo ou pelo email (tentativas de login que falharam, por exemplo).
+// Um limit menor ou igual a zero retorna todos os eventos.
+func (as *AuditService) ForUser(ctx context.Context, user *User, limit int) ([]AuditEvent, error) {
+	clauses := `
+		WHERE audit_events.actor_id = $1
+			OR audit_events.target_id = $1
+			OR audit_events.email = $2
+		ORDER BY audit_events.created_at DESC`
+	args := []interface{}{user.ID, user.Email}
+	if limit > 0 {
+		clauses += `
+		LIMIT $3`
+		args = append(args, limit)
+	}
+	events, err := as.query(ctx, clauses, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit events for user: %w", err)
+	}
+	return events, nil
+}
+
+func (as *AuditService) List(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	var conds []string
+	var args []interface{}
+	// adiciona o argumento e retorna o placeholder correspondente
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.Action != "" {
+		conds = append(conds, "audit_events.action = "+arg(filter.Action))
+	}
+	if filter.UserID != 0 {
+		p := arg(filter.UserID)
+		conds = append(conds, "(audit_events.actor_id = "+p+" OR audit_events.target_id = "+p+")")
+	}
+	if filter.Email != "" {
+		p := arg("%" + strings.ToLower(filter.Email) + "%")
+		conds = append(conds, "(audit_events.email LIKE "+p+
+			" OR actors.email LIKE "+p+" OR targets.email LIKE "+p+")")
+	}
+	if !filter.Since.IsZero() {
+		conds = append(conds, "audit_events.created_at >= "+arg(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conds = append(conds, "audit_events.created_at < "+arg(filter.Until))
+	}
+	var where string
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultAuditLimit
+	}
+	events, err := as.query(ctx, where+`
+		ORDER BY audit_events.created_at DESC
+		LIMIT `+arg(limit), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list audit events: %w", err)
+	}
+	return events, nil
+}
+
+// query executa o select base dos eventos com as condições informadas
+func (as *AuditService) query(ctx context.Context, clauses string, args ...interface{}) ([]AuditEvent, error) {
+	rows, err := conn(ctx, reader(as.DB, as.Replica)).QueryContext(ctx, `
+		SELECT audit_events.id,
+			COALESCE(audit_events.actor_id, 0),
+			audit_events.action,
+			COALESCE(audit_events.target_id, 0),
+			audit_events.email,
+			audit_events.ip_address,
+			audit_events.user_agent,
+			audit_events.created_at,
+			COALESCE(actors.email, ''),
+			COALESCE(targets.email, '')
+		FROM audit_events
+			LEFT JOIN users actors ON actors.id = audit_events.actor_id
+			LEFT JOIN users targets ON targets.id = audit_events.target_id
+		`+clauses+`;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		err = rows.Scan(&event.ID, &event.ActorID, &event.Action, &event.TargetID,
+			&event.Email, &event.IPAddress, &event.UserAgent, &event.CreatedAt,
+			&event.ActorEmail, &event.TargetEmail)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// converte ids zerados em NULL para as colunas de chave estrangeira opcionais
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// DeleteBefore remove os eventos registrados antes de t, usado para limitar
+// por quanto tempo a trilha de auditoria é guardada
+func (as *AuditService) DeleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := conn(ctx, as.DB).ExecContext(ctx, `
+		DELETE FROM audit_events
+		WHERE created_at < $1;`, t)
+	if err != nil {
+		return 0, fmt.Errorf("delete audit events: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete audit events: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditServiceRecordAndForUser(t *testing.T) {
+	f := newFixtures(t)
+	as := AuditService{DB: f.db}
+	user := f.userWithEmail("jon@example.com")
+	other := f.user()
+	now := time.Now()
+	events := []AuditEvent{
+		{ActorID: user.ID, TargetID: user.ID, Action: AuditSignIn, CreatedAt: now.Add(-3 * time.Minute)},
+		{Email: "JON@example.com", Action: AuditSignInFailed, CreatedAt: now.Add(-2 * time.Minute)},
+		{ActorID: other.ID, TargetID: user.ID, Action: AuditInvitationSent, CreatedAt: now.Add(-time.Minute)},
+		{ActorID: other.ID, Action: AuditSignIn, CreatedAt: now},
+	}
+	for _, event := range events {
+		event.IPAddress = "192.0.2.1"
+		event.UserAgent = "test"
+		err := as.Record(f.ctx, event)
+		if err != nil {
+			t.Fatalf("Record() err = %v", err)
+		}
+	}
+
+	got, err := as.ForUser(f.ctx, user, 0)
+	if err != nil {
+		t.Fatalf("ForUser() err = %v", err)
+	}
+	wantActions := []string{AuditInvitationSent, AuditSignInFailed, AuditSignIn}
+	if len(got) != len(wantActions) {
+		t.Fatalf("ForUser() returned %d events, want %d", len(got), len(wantActions))
+	}
+	for i, action := range wantActions {
+		if got[i].Action != action {
+			t.Errorf("event %d action = %q, want %q", i, got[i].Action, action)
+		}
+	}
+	if got[0].ActorEmail != other.Email || got[0].TargetEmail != user.Email {
+		t.Errorf("event emails = %q, %q; want %q, %q",
+			got[0].ActorEmail, got[0].TargetEmail, other.Email, user.Email)
+	}
+	if got[1].Email != "jon@example.com" || got[1].ActorID != 0 {
+		t.Errorf("failed sign in event = %+v, want lowercased email and no actor", got[1])
+	}
+	if got[2].IPAddress != "192.0.2.1" || got[2].UserAgent != "test" {
+		t.Errorf("event origin = %q, %q", got[2].IPAddress, got[2].UserAgent)
+	}
+
+	limited, err := as.ForUser(f.ctx, user, 1)
+	if err != nil {
+		t.Fatalf("ForUser() with limit err = %v", err)
+	}
+	if len(limited) != 1 || limited[0].Action != AuditInvitationSent {
+		t.Errorf("ForUser() with limit = %+v, want the latest event", limited)
+	}
+}
+
+func TestAuditServiceList(t *testing.T) {
+	f := newFixtures(t)
+	as := AuditService{DB: f.db}
+	jon := f.userWithEmail("jon@example.com")
+	ana := f.userWithEmail("ana@example.com")
+	now := time.Now()
+	for _, event := range []AuditEvent{
+		{ActorID: jon.ID, TargetID: jon.ID, Action: AuditSignIn, CreatedAt: now.Add(-2 * time.Hour)},
+		{ActorID: ana.ID, TargetID: ana.ID, Action: AuditSignIn, CreatedAt: now.Add(-time.Hour)},
+		{Email: "someone@example.com", Action: AuditSignInFailed, CreatedAt: now},
+	} {
+		err := as.Record(f.ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		filter AuditFilter
+		want   int
+	}{
+		"no filter":    {AuditFilter{}, 3},
+		"action":       {AuditFilter{Action: AuditSignIn}, 2},
+		"user":         {AuditFilter{UserID: jon.ID}, 1},
+		"actor email":  {AuditFilter{Email: "ANA@"}, 1},
+		"event email":  {AuditFilter{Email: "someone"}, 1},
+		"since":        {AuditFilter{Since: now.Add(-90 * time.Minute)}, 2},
+		"until":        {AuditFilter{Until: now.Add(-90 * time.Minute)}, 1},
+		"limit":        {AuditFilter{Limit: 2}, 2},
+		"combined":     {AuditFilter{Action: AuditSignIn, Since: now.Add(-90 * time.Minute)}, 1},
+		"no match":     {AuditFilter{Action: AuditDataExported}, 0},
+		"email + user": {AuditFilter{Email: "ana", UserID: jon.ID}, 0},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := as.List(f.ctx, tc.filter)
+			if err != nil {
+				t.Fatalf("List() err = %v", err)
+			}
+			if len(got) != tc.want {
+				t.Errorf("List() returned %d events, want %d", len(got), tc.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].CreatedAt.After(got[i-1].CreatedAt) {
+					t.Errorf("events are not ordered from newest to oldest")
+				}
+			}
+		})
+	}
+}
+
+func TestAuditServiceDeleteBefore(t *testing.T) {
+	f := newFixtures(t)
+	as := AuditService{DB: f.db}
+	now := time.Now()
+	for _, createdAt := range []time.Time{now.Add(-48 * time.Hour), now.Add(-47 * time.Hour), now} {
+		err := as.Record(f.ctx, AuditEvent{Action: AuditSignInFailed, CreatedAt: createdAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := as.DeleteBefore(f.ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteBefore() err = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteBefore() = %d, want 2", n)
+	}
+	if left := f.count("audit_events", "TRUE"); left != 1 {
+		t.Errorf("%d events left, want 1", left)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Bancos suportados. Os nomes são os mesmos usados pelo goose e por DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Dialect isola o que muda entre os bancos suportados. As queries dos serviços
+// são escritas para o Postgres, com placeholders $1, ON CONFLICT e RETURNING;
+// o SQLite entende essa sintaxe e o que sobra, como FOR UPDATE, é traduzido
+// pela conexão aberta por OpenSQLite. O que não dá para resolver no texto da
+// query, como erros e locks, passa pelo Dialect do banco.
+type Dialect interface {
+	// Name is one of DriverPostgres or DriverSQLite
+	Name() string
+	// IsUniqueViolation reports whether err was caused by a unique constraint
+	IsUniqueViolation(err error) bool
+	// Lock espera até obter o lock identificado por key. O lock dura até que
+	// unlock seja chamado
+	Lock(ctx context.Context, db *sql.DB, key int64) (unlock func(), err error)
+	// TryLock é como Lock, mas retorna ok false em vez de esperar quando o
+	// lock já pertence a outro
+	TryLock(ctx context.Context, db *sql.DB, key int64) (unlock func(), ok bool, err error)
+	// TableExists reports whether the table exists, without creating it
+	TableExists(ctx context.Context, db *sql.DB, table string) (bool, error)
+	// CheckWritable retorna ErrReadOnly se o banco não aceitar escritas, como
+	// uma réplica do Postgres ou um arquivo do SQLite sem permissão de escrita
+	CheckWritable(ctx context.Context, db *sql.DB) error
+}
+
+// ErrReadOnly is returned by Dialect.CheckWritable when the database can't be
+// written to.
+var ErrReadOnly = errors.New("models: database is read-only")
+
+// DialectOf retorna o dialeto do banco. Conexões que não foram abertas por
+// este pacote são tratadas como Postgres.
+func DialectOf(db *sql.DB) Dialect {
+	if d, ok := db.Driver().(dialectDriver); ok {
+		return d.dialect
+	}
+	return Postgres
+}
+
+// openDB abre o *sql.DB com as conexões de drv instrumentadas pelo otelsql. O
+// dialeto fica guardado no connector do próprio *sql.DB, assim os serviços
+// continuam recebendo apenas o *sql.DB e nada sobra depois do Close
+func openDB(drv driver.Driver, dsn string, d Dialect, system attribute.KeyValue) (*sql.DB, error) {
+	// o otelsql mantém a interface DriverContext dos drivers que a implementam
+	otelDriver, ok := otelsql.WrapDriver(drv, otelOptions(system)...).(driver.DriverContext)
+	if !ok {
+		return nil, fmt.Errorf("driver %T does not implement driver.DriverContext", drv)
+	}
+	connector, err := otelDriver.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(dialectConnector{Connector: connector, dialect: d}), nil
+}
+
+// dialectConnector é o connector dos bancos abertos por openDB. O *sql.DB só
+// expõe o driver do connector, então é por ele que DialectOf chega ao dialeto
+type dialectConnector struct {
+	driver.Connector
+	dialect Dialect
+}
+
+func (c dialectConnector) Driver() driver.Driver {
+	return dialectDriver{Driver: c.Connector.Driver(), dialect: c.dialect}
+}
+
+// Close implements io.Closer, que o *sql.DB só procura no connector mais
+// externo
+func (c dialectConnector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type dialectDriver struct {
+	driver.Driver
+	dialect Dialect
+}
@@ -1,9 +1,14 @@
 package models
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"time"
 
-	"github.com/go-mail/mail"
+	"github.com/vitoraalmeida/lenslocked/metrics"
+	"github.com/vitoraalmeida/lenslocked/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -11,16 +16,12 @@ const (
 	DefaultSender = "support@lenslocked.com"
 )
 
-type SMTPConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
-}
-
-func NewEmailService(config SMTPConfig) *EmailService {
+// NewEmailService cria o serviço que monta os emails a partir dos templates e
+// os entrega através do Mailer informado (SMTP, arquivos ou memória)
+func NewEmailService(mailer Mailer, templates *EmailTemplates) *EmailService {
 	es := EmailService{
-		dialer: mail.NewDialer(config.Host, config.Port, config.Username, config.Password),
+		mailer:    mailer,
+		templates: templates,
 	}
 	return &es
 }
@@ -31,8 +32,13 @@ type EmailService struct {
 	// like the forgotten password email.
 	DefaultSender string
 
+	// Outbox, when set, makes Send queue emails to be delivered later by an
+	// EmailWorker instead of talking to the SMTP server during the request.
+	Outbox *EmailOutbox
+
 	// unexported fields
-	dialer *mail.Dialer
+	mailer    Mailer
+	templates *EmailTemplates
 }
 
 type Email struct {
@@ -43,54 +49,190 @@ type Email struct {
 	HTML      string
 }
 
-func (es *EmailService) Send(email Email) error {
-	msg := mail.NewMessage()
-	msg.SetHeader("To", email.To)
-	es.setFrom(msg, email)
-	msg.SetHeader("Subject", email.Subject)
-	switch {
-	case email.Plaintext != "" && email.HTML != "":
-		msg.SetBody("text/plain", email.Plaintext)
-		msg.AddAlternative("text/html", email.HTML)
-	case email.Plaintext != "":
-		msg.SetBody("text/plain", email.Plaintext)
-	case email.HTML != "":
-		msg.SetBody("text/html", email.HTML)
+// Send envia o email, ou o coloca na fila caso o EmailService tenha uma Outbox
+func (es *EmailService) Send(ctx context.Context, email Email) error {
+	if es.Outbox != nil {
+		email.From = es.from(email)
+		err := es.Outbox.Enqueue(ctx, email)
+		if err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+		return nil
 	}
-	err := es.dialer.DialAndSend(msg)
+	return es.Deliver(ctx, email)
+}
+
+// Deliver envia o email imediatamente pelo Mailer
+func (es *EmailService) Deliver(ctx context.Context, email Email) error {
+	email.From = es.from(email)
+	_, span := tracing.Start(ctx, "email.deliver",
+		attribute.String("email.transport", fmt.Sprintf("%T", es.mailer)))
+	err := es.mailer.Send(email)
+	tracing.End(span, err)
+	metrics.EmailSent(err)
 	if err != nil {
-		return fmt.Errorf("send: %w", err)
+		return fmt.Errorf("deliver: %w", err)
 	}
 	return nil
 }
 
-// Used to set the sender of the message. The priority is:
+// Check verifica se o transporte de email está disponível. Transportes que
+// não implementam MailerChecker, como o MemoryMailer, estão sempre disponíveis
+func (es *EmailService) Check(ctx context.Context) error {
+	checker, ok := es.mailer.(MailerChecker)
+	if !ok {
+		return nil
+	}
+	return checker.Check(ctx)
+}
+
+// Close libera os recursos do Mailer, como conexões SMTP abertas
+func (es *EmailService) Close() error {
+	return es.mailer.Close()
+}
+
+// Used to determine the sender of the message. The priority is:
 //   - email.From
 //   - EmailService.DefaultSender
 //   - DefaultSender (package const)
-func (es *EmailService) setFrom(msg *mail.Message, email Email) {
-	var from string
+func (es *EmailService) from(email Email) string {
 	switch {
 	case email.From != "":
-		from = email.From
+		return email.From
 	case es.DefaultSender != "":
-		from = es.DefaultSender
+		return es.DefaultSender
 	default:
-		from = DefaultSender
+		return DefaultSender
 	}
-	msg.SetHeader("From", from)
 }
 
-func (es *EmailService) ForgotPassword(to, resetURL string) error {
-	email := Email{
-		Subject:   "Reset your password",
-		To:        to,
-		Plaintext: "To reset your password, please visit the following link: " + resetURL,
-		HTML:      `<p>To reset your password, please visit the following link: <a href="` + resetURL + `">` + resetURL + `</a></p>`,
+// Nomes dos templates em templates/email usados por cada mensagem
+const (
+	EmailResetPassword      = "reset-pw"
+	EmailVerify             = "verify-email"
+	EmailInvite             = "invite"
+	EmailOrganizationInvite = "organization-invite"
+	EmailSecurityAlert      = "security-alert"
+)
+
+// SecurityAlert descreve uma ação sensível feita na conta do usuário, como a
+// troca de senha, para que ele seja avisado caso não a reconheça.
+type SecurityAlert struct {
+	Summary   string
+	Time      time.Time
+	IPAddress string
+	UserAgent string
+}
+
+// sendTemplate renderiza o template da mensagem e envia para o destinatário
+func (es *EmailService) sendTemplate(ctx context.Context, to, name string, data interface{}) error {
+	email, err := es.templates.Render(name, data)
+	if err != nil {
+		return err
 	}
-	err := es.Send(email)
+	email.To = to
+	return es.Send(ctx, email)
+}
+
+func (es *EmailService) ForgotPassword(ctx context.Context, to, resetURL string) error {
+	data := struct {
+		ResetURL string
+	}{resetURL}
+	err := es.sendTemplate(ctx, to, EmailResetPassword, data)
 	if err != nil {
 		return fmt.Errorf("forgot password email: %w", err)
 	}
 	return nil
 }
+
+func (es *EmailService) VerifyEmail(ctx context.Context, to, verifyURL string) error {
+	data := struct {
+		VerifyURL string
+	}{verifyURL}
+	err := es.sendTemplate(ctx, to, EmailVerify, data)
+	if err != nil {
+		return fmt.Errorf("verify email: %w", err)
+	}
+	return nil
+}
+
+func (es *EmailService) Invite(ctx context.Context, to, invitedBy, inviteURL string) error {
+	data := struct {
+		InvitedBy string
+		InviteURL string
+	}{invitedBy, inviteURL}
+	err := es.sendTemplate(ctx, to, EmailInvite, data)
+	if err != nil {
+		return fmt.Errorf("invite email: %w", err)
+	}
+	return nil
+}
+
+func (es *EmailService) OrganizationInvite(ctx context.Context, to, invitedBy, orgName, joinURL string) error {
+	data := struct {
+		InvitedBy    string
+		Organization string
+		JoinURL      string
+	}{invitedBy, orgName, joinURL}
+	err := es.sendTemplate(ctx, to, EmailOrganizationInvite, data)
+	if err != nil {
+		return fmt.Errorf("organization invite email: %w", err)
+	}
+	return nil
+}
+
+func (es *EmailService) SecurityAlert(ctx context.Context, to string, alert SecurityAlert) error {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	err := es.sendTemplate(ctx, to, EmailSecurityAlert, alert)
+	if err != nil {
+		return fmt.Errorf("security alert email: %w", err)
+	}
+	return nil
+}
+
+// Preview renderiza a mensagem com dados de exemplo, para que os templates
+// possam ser visualizados durante o desenvolvimento sem enviar emails.
+func (es *EmailService) Preview(name string) (Email, error) {
+	data, ok := es.previewData()[name]
+	if !ok {
+		return Email{}, fmt.Errorf("preview email: unknown template %q", name)
+	}
+	email, err := es.templates.Render(name, data)
+	if err != nil {
+		return Email{}, fmt.Errorf("preview email: %w", err)
+	}
+	email.To = "jon@example.com"
+	email.From = es.from(email)
+	return email, nil
+}
+
+// PreviewNames retorna os nomes das mensagens que podem ser visualizadas
+func (es *EmailService) PreviewNames() []string {
+	return es.templates.Names()
+}
+
+func (es *EmailService) previewData() map[string]interface{} {
+	token := url.Values{"token": {"preview-token"}}
+	return map[string]interface{}{
+		EmailResetPassword: struct{ ResetURL string }{
+			es.templates.url("/reset-pw", token),
+		},
+		EmailVerify: struct{ VerifyURL string }{
+			es.templates.url("/verify-email", token),
+		},
+		EmailInvite: struct{ InvitedBy, InviteURL string }{
+			"jane@example.com", es.templates.url("/signup", token),
+		},
+		EmailOrganizationInvite: struct{ InvitedBy, Organization, JoinURL string }{
+			"jane@example.com", "Example Studio", es.templates.url("/organizations/join", token),
+		},
+		EmailSecurityAlert: SecurityAlert{
+			Summary:   "Your password was changed.",
+			Time:      time.Date(2023, 8, 1, 14, 30, 0, 0, time.UTC),
+			IPAddress: "203.0.113.7",
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/116.0",
+		},
+	}
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultOutboxMaxAttempts is the default number of times the worker tries
+	// to send an email before moving it to the dead letters.
+	DefaultOutboxMaxAttempts = 8
+	// DefaultOutboxBackoff is the wait before the first retry. It doubles on
+	// every failed attempt, up to DefaultOutboxMaxBackoff.
+	DefaultOutboxBackoff    = 30 * time.Second
+	DefaultOutboxMaxBackoff = 1 * time.Hour
+	// DefaultOutboxLease is how long a claimed email is hidden from other
+	// workers while it is being sent.
+	DefaultOutboxLease = 5 * time.Minute
+
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// redactBody apaga o conteúdo de um email que saiu da fila. Os emails de reset
+// e de convite carregam tokens válidos, então não podem ficar no banco (nem
+// nos backups) depois de enviados ou desistidos
+const redactBody = `plaintext = '', html = ''`
+
+// OutboxEmail é um email guardado na fila de envio. Depois de enviado ou
+// movido para os dead letters só restam o destinatário, o assunto e o status
+type OutboxEmail struct {
+	ID int
+	Email
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+// EmailOutbox é uma fila de emails persistida no banco. Os emails são
+// inseridos na mesma hora em que a requisição acontece e enviados depois pelo
+// EmailWorker, assim uma falha no servidor SMTP não faz o email ser perdido
+// nem retorna um erro para o usuário.
+type EmailOutbox struct {
+	DB *sql.DB
+	// MaxAttempts defaults to DefaultOutboxMaxAttempts
+	MaxAttempts int
+	// Backoff and MaxBackoff default to DefaultOutboxBackoff and
+	// DefaultOutboxMaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease defaults to DefaultOutboxLease
+	Lease time.Duration
+}
+
+func (o *EmailOutbox) Enqueue(ctx context.Context, email Email) error {
+	now := time.Now()
+	_, err := conn(ctx, o.DB).ExecContext(ctx, `
+		INSERT INTO email_outbox (sender, recipient, subject, plaintext, html, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6);`,
+		email.From, email.To, email.Subject, email.Plaintext, email.HTML, now)
+	if err != nil {
+		return fmt.Errorf("enqueue email: %w", err)
+	}
+	return nil
+}
+
+// Claim reserva até limit emails prontos para envio. Os emails reservados só
+// voltam a ficar disponíveis para outros workers depois do Lease, o que
+// permite rodar mais de uma instância da aplicação sem envios duplicados.
+func (o *EmailOutbox) Claim(ctx context.Context, limit int) ([]OutboxEmail, error) {
+	lease := o.Lease
+	if lease == 0 {
+		lease = DefaultOutboxLease
+	}
+	now := time.Now()
+	rows, err := conn(ctx, o.DB).QueryContext(ctx, `
+		UPDATE email_outbox
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id
+			FROM email_outbox
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, sender, recipient, subject, plaintext, html, attempts;`,
+		now.Add(lease), OutboxPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim emails: %w", err)
+	}
+	defer rows.Close()
+	var emails []OutboxEmail
+	for rows.Next() {
+		var email OutboxEmail
+		err = rows.Scan(&email.ID, &email.From, &email.To, &email.Subject,
+			&email.Plaintext, &email.HTML, &email.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("claim emails: %w", err)
+		}
+		email.Status = OutboxPending
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("claim emails: %w", err)
+	}
+	return emails, nil
+}
+
+func (o *EmailOutbox) MarkSent(ctx context.Context, id int) error {
+	_, err := conn(ctx, o.DB).ExecContext(ctx, `
+		UPDATE email_outbox
+		SET status = $2, attempts = attempts + 1, sent_at = $3, last_error = '',
+			`+redactBody+`
+		WHERE id = $1;`, id, OutboxSent, time.Now())
+	if err != nil {
+		return fmt.Errorf("mark email sent: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed registra a falha no envio e agenda uma nova tentativa com backoff
+// exponencial. Ao atingir o máximo de tentativas o email vai para os dead
+// letters, sem o conteúdo.
+func (o *EmailOutbox) MarkFailed(ctx context.Context, email OutboxEmail, sendErr error) error {
+	maxAttempts := o.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultOutboxMaxAttempts
+	}
+	attempts := email.Attempts + 1
+	status := OutboxPending
+	set := `status = $2, attempts = $3, last_error = $4, next_attempt_at = $5`
+	if attempts >= maxAttempts {
+		status = OutboxDead
+		set += `, ` + redactBody
+	}
+	_, err := conn(ctx, o.DB).ExecContext(ctx, `
+		UPDATE email_outbox
+		SET `+set+`
+		WHERE id = $1;`,
+		email.ID, status, attempts, sendErr.Error(), time.Now().Add(o.backoff(attempts)))
+	if err != nil {
+		return fmt.Errorf("mark email failed: %w", err)
+	}
+	return nil
+}
+
+// DeadLetters lista os emails que não puderam ser enviados
+func (o *EmailOutbox) DeadLetters(ctx context.Context, limit int) ([]OutboxEmail, error) {
+	rows, err := conn(ctx, o.DB).QueryContext(ctx, `
+		SELECT id, sender, recipient, subject, attempts, last_error, created_at
+		FROM email_outbox
+		WHERE status = $1
+		ORDER BY created_at DESC
+		LIMIT $2;`, OutboxDead, limit)
+	if err != nil {
+		return nil, fmt.Errorf("dead letters: %w", err)
+	}
+	defer rows.Close()
+	var emails []OutboxEmail
+	for rows.Next() {
+		email := OutboxEmail{Status: OutboxDead}
+		err = rows.Scan(&email.ID, &email.From, &email.To, &email.Subject,
+			&email.Attempts, &email.LastError, &email.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("dead letters: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("dead letters: %w", err)
+	}
+	return emails, nil
+}
+
+// DeleteBefore remove os emails enviados ou desistidos que entraram na fila
+// antes de t. Os pendentes ficam, por mais antigos que sejam
+func (o *EmailOutbox) DeleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := conn(ctx, o.DB).ExecContext(ctx, `
+		DELETE FROM email_outbox
+		WHERE status <> $1 AND created_at < $2;`, OutboxPending, t)
+	if err != nil {
+		return 0, fmt.Errorf("delete outbox emails: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete outbox emails: %w", err)
+	}
+	return n, nil
+}
+
+func (o *EmailOutbox) backoff(attempts int) time.Duration {
+	backoff := o.Backoff
+	if backoff == 0 {
+		backoff = DefaultOutboxBackoff
+	}
+	maxBackoff := o.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultOutboxMaxBackoff
+	}
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+const (
+	// DefaultEmailWorkerInterval is how often the worker looks for emails to
+	// send when the outbox is empty.
+	DefaultEmailWorkerInterval = 5 * time.Second
+	// DefaultEmailWorkerBatchSize is the number of emails claimed at once.
+	DefaultEmailWorkerBatchSize = 10
+)
+
+// EmailWorker envia os emails da EmailOutbox em segundo plano
+type EmailWorker struct {
+	Outbox       *EmailOutbox
+	EmailService *EmailService
+	// Interval defaults to DefaultEmailWorkerInterval
+	Interval time.Duration
+	// BatchSize defaults to DefaultEmailWorkerBatchSize
+	BatchSize int
+}
+
+// Run processa a fila até que o ctx seja cancelado
+func (ew *EmailWorker) Run(ctx context.Context) {
+	interval := ew.Interval
+	if interval == 0 {
+		interval = DefaultEmailWorkerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// enquanto houver emails na fila, processa sem esperar o próximo tick
+		for {
+			n, err := ew.process(ctx)
+			if err != nil {
+				slog.Error("email worker", "error", err)
+				break
+			}
+			if n == 0 || ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process envia um lote de emails e retorna quantos foram processados
+func (ew *EmailWorker) process(ctx context.Context) (int, error) {
+	batchSize := ew.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultEmailWorkerBatchSize
+	}
+	emails, err := ew.Outbox.Claim(ctx, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("email worker: %w", err)
+	}
+	for _, email := range emails {
+		sendErr := ew.EmailService.Deliver(ctx, email.Email)
+		if sendErr != nil {
+			err = ew.Outbox.MarkFailed(ctx, email, sendErr)
+		} else {
+			err = ew.Outbox.MarkSent(ctx, email.ID)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("email worker: %w", err)
+		}
+	}
+	return len(emails), nil
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmailOutboxClaimAndMarkSent(t *testing.T) {
+	f := newFixtures(t)
+	o := EmailOutbox{DB: f.db, Lease: time.Hour}
+	email := Email{
+		From:      "from@example.com",
+		To:        "to@example.com",
+		Subject:   "Hi",
+		Plaintext: "Hello",
+		HTML:      "<p>Hello</p>",
+	}
+	err := o.Enqueue(f.ctx, email)
+	if err != nil {
+		t.Fatalf("Enqueue() err = %v", err)
+	}
+
+	claimed, err := o.Claim(f.ctx, 10)
+	if err != nil {
+		t.Fatalf("Claim() err = %v", err)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("Claim() returned %d emails, want 1", len(claimed))
+	}
+	if claimed[0].Email != email || claimed[0].Status != OutboxPending || claimed[0].Attempts != 0 {
+		t.Errorf("Claim() = %+v, want %+v", claimed[0], email)
+	}
+	// enquanto durar o lease o email não é entregue a outro worker
+	again, err := o.Claim(f.ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second Claim() returned %d emails, want 0", len(again))
+	}
+
+	err = o.MarkSent(f.ctx, claimed[0].ID)
+	if err != nil {
+		t.Fatalf("MarkSent() err = %v", err)
+	}
+	if n := f.count("email_outbox", "status = $1 AND attempts = 1", OutboxSent); n != 1 {
+		t.Errorf("%d sent emails, want 1", n)
+	}
+	// o corpo pode ter um link com token e não fica guardado após o envio
+	if n := f.count("email_outbox", "plaintext = '' AND html = ''"); n != 1 {
+		t.Errorf("sent email body was not redacted")
+	}
+}
+
+func TestEmailOutboxClaimLimit(t *testing.T) {
+	f := newFixtures(t)
+	o := EmailOutbox{DB: f.db}
+	for i := 0; i < 3; i++ {
+		err := o.Enqueue(f.ctx, Email{To: "to@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	claimed, err := o.Claim(f.ctx, 2)
+	if err != nil {
+		t.Fatalf("Claim() err = %v", err)
+	}
+	if len(claimed) != 2 {
+		t.Errorf("Claim(2) returned %d emails", len(claimed))
+	}
+	rest, err := o.Claim(f.ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 {
+		t.Errorf("second Claim(2) returned %d emails, want 1", len(rest))
+	}
+}
+
+func TestEmailOutboxMarkFailed(t *testing.T) {
+	f := newFixtures(t)
+	o := EmailOutbox{DB: f.db, MaxAttempts: 2, Backoff: time.Hour}
+	err := o.Enqueue(f.ctx, Email{To: "to@example.com", Subject: "Hi", Plaintext: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := o.Claim(f.ctx, 1)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("Claim() = %v, %v", claimed, err)
+	}
+
+	err = o.MarkFailed(f.ctx, claimed[0], errors.New("smtp down"))
+	if err != nil {
+		t.Fatalf("MarkFailed() err = %v", err)
+	}
+	if n := f.count("email_outbox", "status = $1 AND attempts = 1 AND next_attempt_at > $2",
+		OutboxPending, time.Now().Add(50*time.Minute)); n != 1 {
+		t.Errorf("email was not rescheduled with the backoff")
+	}
+
+	claimed[0].Attempts = 1
+	err = o.MarkFailed(f.ctx, claimed[0], errors.New("smtp still down"))
+	if err != nil {
+		t.Fatalf("second MarkFailed() err = %v", err)
+	}
+	dead, err := o.DeadLetters(f.ctx, 10)
+	if err != nil {
+		t.Fatalf("DeadLetters() err = %v", err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("DeadLetters() returned %d emails, want 1", len(dead))
+	}
+	if dead[0].Attempts != 2 || dead[0].LastError != "smtp still down" || dead[0].Subject != "Hi" {
+		t.Errorf("DeadLetters() = %+v", dead[0])
+	}
+	if n := f.count("email_outbox", "plaintext = '' AND html = ''"); n != 1 {
+		t.Errorf("dead letter body was not redacted")
+	}
+}
+
+func TestEmailOutboxDeleteBefore(t *testing.T) {
+	f := newFixtures(t)
+	o := EmailOutbox{DB: f.db}
+	now := time.Now()
+	for _, status := range []string{OutboxSent, OutboxDead, OutboxPending} {
+		f.exec(`INSERT INTO email_outbox (sender, recipient, subject, plaintext, html, status, next_attempt_at, created_at)
+			VALUES ('', 'to@example.com', '', '', '', $1, $2, $2);`, status, now.Add(-48*time.Hour))
+	}
+	err := o.Enqueue(f.ctx, Email{To: "to@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.exec(`UPDATE email_outbox SET status = $1 WHERE created_at > $2;`, OutboxSent, now.Add(-time.Hour))
+
+	n, err := o.DeleteBefore(f.ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteBefore() err = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteBefore() = %d, want 2", n)
+	}
+	// o pendente antigo e o enviado recente continuam na tabela
+	if left := f.count("email_outbox", "TRUE"); left != 2 {
+		t.Errorf("%d emails left, want 2", left)
+	}
+}
+
+func TestEmailOutboxBackoff(t *testing.T) {
+	o := EmailOutbox{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+		9: 5 * time.Second,
+	}
+	for attempts, want := range tests {
+		if got := o.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+	var defaults EmailOutbox
+	if got := defaults.backoff(1); got != DefaultOutboxBackoff {
+		t.Errorf("default backoff(1) = %v, want %v", got, DefaultOutboxBackoff)
+	}
+}
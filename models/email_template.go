@@ -0,0 +1,161 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/vitoraalmeida/lenslocked/urls"
+)
+
+const (
+	emailHTMLExt = ".gohtml"
+	emailTextExt = ".gotxt"
+	// arquivos de layout compartilhados por todos os emails
+	emailLayout = "layout"
+)
+
+// EmailTemplates renderiza os emails transacionais a partir de pares de
+// arquivos <nome>.gohtml e <nome>.gotxt que definem os blocos "subject" e
+// "content". O conteúdo é inserido no layout.gohtml/layout.gotxt, que é
+// compartilhado por todas as mensagens.
+//
+// Os templates podem usar a função url para gerar links absolutos, por
+// exemplo {{url "/signin"}}.
+type EmailTemplates struct {
+	// URLs defaults to a Builder without a base URL (urls.DefaultBaseURL)
+	URLs *urls.Builder
+
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+}
+
+// ParseEmailTemplates faz o parsing de todos os templates de email no
+// diretório dir do fsys. Cada mensagem precisa ter as duas versões (HTML e
+// texto), assim nenhum email é enviado sem a alternativa em texto puro.
+func ParseEmailTemplates(fsys fs.FS, dir string) (*EmailTemplates, error) {
+	// assim como em views.ParseFS, a função url é só um placeholder durante o
+	// parsing e é substituída em Render
+	urlFunc := func(string) (string, error) {
+		return "", fmt.Errorf("url not implemented")
+	}
+	layoutName := emailLayout + emailHTMLExt
+	htmlLayout, err := htmltemplate.New(layoutName).
+		Funcs(htmltemplate.FuncMap{"url": urlFunc}).
+		ParseFS(fsys, path.Join(dir, layoutName))
+	if err != nil {
+		return nil, fmt.Errorf("parse email templates: %w", err)
+	}
+	layoutName = emailLayout + emailTextExt
+	textLayout, err := texttemplate.New(layoutName).
+		Funcs(texttemplate.FuncMap{"url": urlFunc}).
+		ParseFS(fsys, path.Join(dir, layoutName))
+	if err != nil {
+		return nil, fmt.Errorf("parse email templates: %w", err)
+	}
+	names, err := fs.Glob(fsys, path.Join(dir, "*"+emailHTMLExt))
+	if err != nil {
+		return nil, fmt.Errorf("parse email templates: %w", err)
+	}
+	et := EmailTemplates{
+		html: make(map[string]*htmltemplate.Template),
+		text: make(map[string]*texttemplate.Template),
+	}
+	for _, file := range names {
+		name := strings.TrimSuffix(path.Base(file), emailHTMLExt)
+		if name == emailLayout {
+			continue
+		}
+		// cada mensagem usa uma cópia do layout, pois todas definem os mesmos
+		// blocos "subject" e "content"
+		htmlTpl, err := htmlLayout.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("parse email template %s: %w", name, err)
+		}
+		htmlTpl, err = htmlTpl.ParseFS(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("parse email template %s: %w", name, err)
+		}
+		textTpl, err := textLayout.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("parse email template %s: %w", name, err)
+		}
+		textTpl, err = textTpl.ParseFS(fsys, path.Join(dir, name+emailTextExt))
+		if err != nil {
+			return nil, fmt.Errorf("parse email template %s: %w", name, err)
+		}
+		et.html[name] = htmlTpl
+		et.text[name] = textTpl
+	}
+	return &et, nil
+}
+
+// Render executa o template da mensagem e retorna um Email com o assunto e os
+// corpos em HTML e texto preenchidos. Destinatário e remetente ficam a cargo de
+// quem chama.
+func (et *EmailTemplates) Render(name string, data interface{}) (Email, error) {
+	htmlTpl, ok := et.html[name]
+	if !ok {
+		return Email{}, fmt.Errorf("render email: unknown template %q", name)
+	}
+	textTpl := et.text[name]
+	// os templates são compartilhados entre goroutines, então a função url é
+	// definida numa cópia
+	htmlTpl, err := htmlTpl.Clone()
+	if err != nil {
+		return Email{}, fmt.Errorf("render email %s: %w", name, err)
+	}
+	textTpl, err = textTpl.Clone()
+	if err != nil {
+		return Email{}, fmt.Errorf("render email %s: %w", name, err)
+	}
+	urlFunc := func(path string) string {
+		return et.url(path, nil)
+	}
+	htmlTpl = htmlTpl.Funcs(htmltemplate.FuncMap{"url": urlFunc})
+	textTpl = textTpl.Funcs(texttemplate.FuncMap{"url": urlFunc})
+
+	var subject, plaintext, html bytes.Buffer
+	err = textTpl.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return Email{}, fmt.Errorf("render email %s: %w", name, err)
+	}
+	err = textTpl.ExecuteTemplate(&plaintext, emailLayout, data)
+	if err != nil {
+		return Email{}, fmt.Errorf("render email %s: %w", name, err)
+	}
+	err = htmlTpl.ExecuteTemplate(&html, emailLayout, data)
+	if err != nil {
+		return Email{}, fmt.Errorf("render email %s: %w", name, err)
+	}
+	return Email{
+		Subject:   strings.TrimSpace(subject.String()),
+		Plaintext: plaintext.String(),
+		HTML:      html.String(),
+	}, nil
+}
+
+// Names retorna os nomes de todas as mensagens disponíveis, em ordem
+// alfabética
+func (et *EmailTemplates) Names() []string {
+	names := make([]string, 0, len(et.html))
+	for name := range et.html {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (et *EmailTemplates) url(path string, query url.Values) string {
+	builder := et.URLs
+	if builder == nil {
+		builder = &urls.Builder{}
+	}
+	return builder.URL(path, query)
+}
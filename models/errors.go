@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Erros de domínio retornados pelos serviços no lugar dos erros do banco ou do
+// bcrypt. Quem chama testa com errors.Is e não precisa saber como os dados
+// são guardados. Os erros mais específicos, como ErrEmailTaken, são também um
+// destes: errors.Is(ErrEmailTaken, ErrConflict) é verdadeiro.
+var (
+	ErrNotFound           = errors.New("models: resource could not be found")
+	ErrInvalidCredentials = errors.New("models: invalid email or password")
+	ErrExpiredToken       = errors.New("models: token is invalid or expired")
+	ErrConflict           = errors.New("models: resource already exists")
+	ErrForbidden          = errors.New("models: user is not allowed to perform this action")
+)
+
+// domainError é um erro específico que pertence a um dos erros de domínio
+type domainError struct {
+	kind error
+	msg  string
+}
+
+func newError(kind error, msg string) error {
+	return domainError{kind: kind, msg: msg}
+}
+
+func (e domainError) Error() string {
+	return e.msg
+}
+
+func (e domainError) Unwrap() error {
+	return e.kind
+}
+
+// noRows troca o sql.ErrNoRows pelo erro de domínio informado, normalmente
+// ErrNotFound
+func noRows(err, domainErr error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domainErr
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportService gera o arquivo com todos os dados que guardamos de um usuário,
+// para que ele possa baixá-los antes de remover a conta (GDPR).
+type ExportService struct {
+	DB *sql.DB
+	// Replica, quando definida, é de onde o export é lido
+	Replica *sql.DB
+}
+
+type exportedProfile struct {
+	ID                  int        `json:"id"`
+	Email               string     `json:"email"`
+	IsAdmin             bool       `json:"is_admin"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	ExportedAt          time.Time  `json:"exported_at"`
+}
+
+type exportedEvent struct {
+	Action    string    `json:"action"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportedMembership struct {
+	OrganizationID int    `json:"organization_id"`
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+}
+
+// exportedInvitation é um convite enviado pelo usuário, para a aplicação ou
+// para uma organização. O token não é exportado.
+type exportedInvitation struct {
+	Email          string    `json:"email"`
+	OrganizationID int       `json:"organization_id,omitempty"`
+	Role           string    `json:"role,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// Write escreve em w um arquivo ZIP com o perfil, o histórico de atividade, as
+// organizações e os convites enviados pelo usuário. O hash da senha e os
+// tokens não são exportados.
+func (es *ExportService) Write(ctx context.Context, w io.Writer, userID int) error {
+	db := reader(es.DB, es.Replica)
+	users := UserService{DB: db}
+	user, err := users.ByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	profile := exportedProfile{
+		ID:         user.ID,
+		Email:      user.Email,
+		IsAdmin:    user.IsAdmin,
+		ExportedAt: time.Now(),
+	}
+	if !user.DeletionScheduledAt.IsZero() {
+		profile.DeletionScheduledAt = &user.DeletionScheduledAt
+	}
+
+	audit := AuditService{DB: db}
+	events, err := audit.ForUser(ctx, user, 0)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	activity := make([]exportedEvent, 0, len(events))
+	for _, event := range events {
+		activity = append(activity, exportedEvent{
+			Action:    event.Action,
+			IPAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	orgs := OrganizationService{DB: db}
+	userOrgs, err := orgs.ForUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	memberships := make([]exportedMembership, 0, len(userOrgs))
+	for _, org := range userOrgs {
+		memberships = append(memberships, exportedMembership{
+			OrganizationID: org.ID,
+			Name:           org.Name,
+			Role:           org.Role,
+		})
+	}
+	invitations, err := es.invitations(ctx, db, userID)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, file := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", profile},
+		{"activity.json", activity},
+		{"organizations.json", memberships},
+		{"invitations.json", invitations},
+	} {
+		err = writeJSON(zw, file.name, file.data)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// invitations lista os convites pendentes enviados pelo usuário
+func (es *ExportService) invitations(ctx context.Context, db *sql.DB, userID int) ([]exportedInvitation, error) {
+	rows, err := conn(ctx, db).QueryContext(ctx, `
+		SELECT email, 0, '', expires_at
+		FROM invitations
+		WHERE invited_by = $1
+		UNION ALL
+		SELECT email, organization_id, role, expires_at
+		FROM organization_invitations
+		WHERE invited_by = $1
+		ORDER BY expires_at;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("invitations: %w", err)
+	}
+	defer rows.Close()
+	invitations := []exportedInvitation{}
+	for rows.Next() {
+		var inv exportedInvitation
+		err = rows.Scan(&inv.Email, &inv.OrganizationID, &inv.Role, &inv.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invitations: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestExportServiceWrite(t *testing.T) {
+	f := newFixtures(t)
+	es := ExportService{DB: f.db}
+	as := AuditService{DB: f.db}
+	user := f.user()
+	err := as.Record(f.ctx, AuditEvent{ActorID: user.ID, Action: AuditSignIn, IPAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgs := OrganizationService{DB: f.db}
+	org, err := orgs.Create(f.ctx, "Acme", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = orgs.Invite(f.ctx, org.ID, "colleague@example.com", RoleEditor, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := InvitationService{DB: f.db}
+	_, err = is.Create(f.ctx, "friend@example.com", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = es.Write(f.ctx, &buf, user.ID)
+	if err != nil {
+		t.Fatalf("Write() err = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip file: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range zr.File {
+		files[file.Name] = file
+	}
+
+	var profile map[string]interface{}
+	readZipJSON(t, files["profile.json"], &profile)
+	if profile["email"] != user.Email {
+		t.Errorf("profile email = %v, want %q", profile["email"], user.Email)
+	}
+	if _, ok := profile["password_hash"]; ok {
+		t.Error("profile exports the password hash")
+	}
+	var activity []exportedEvent
+	readZipJSON(t, files["activity.json"], &activity)
+	if len(activity) != 1 || activity[0].Action != AuditSignIn || activity[0].IPAddress != "192.0.2.1" {
+		t.Errorf("activity = %+v", activity)
+	}
+	var memberships []exportedMembership
+	readZipJSON(t, files["organizations.json"], &memberships)
+	if len(memberships) != 1 || memberships[0].Name != "Acme" || memberships[0].Role != RoleOwner {
+		t.Errorf("organizations = %+v", memberships)
+	}
+	var invitations []exportedInvitation
+	readZipJSON(t, files["invitations.json"], &invitations)
+	if len(invitations) != 2 {
+		t.Errorf("invitations = %+v, want the two invitations sent", invitations)
+	}
+}
+
+func readZipJSON(t *testing.T, file *zip.File, v interface{}) {
+	t.Helper()
+	if file == nil {
+		t.Fatal("file missing from export")
+	}
+	rc, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	err = json.NewDecoder(rc).Decode(v)
+	if err != nil {
+		t.Fatalf("%s: %v", file.Name, err)
+	}
+}
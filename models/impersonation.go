@@ -0,0 +1,215 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/rand"
+)
+
+const (
+	// DefaultImpersonationDuration is the default time that an admin can view
+	// the app as another user before having to start over.
+	DefaultImpersonationDuration = 1 * time.Hour
+
+	ImpersonationStarted = "start"
+	ImpersonationStopped = "stop"
+)
+
+var (
+	ErrImpersonateAdmin = newError(ErrForbidden, "models: admins can't be impersonated")
+)
+
+// Impersonation é uma sessão especial que liga um admin a um usuário alvo.
+// Enquanto estiver ativa, o admin navega no sistema como se fosse o usuário
+// alvo.
+type Impersonation struct {
+	ID      int
+	AdminID int
+	UserID  int
+	// Token is only set when an Impersonation is being created.
+	Token     string
+	TokenHash string
+	StartedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ImpersonationEvent é um evento de personificação da trilha de auditoria.
+// AdminEmail e UserEmail ficam vazios caso o usuário tenha sido deletado.
+type ImpersonationEvent struct {
+	ID         int
+	AdminEmail string
+	UserEmail  string
+	Action     string
+	CreatedAt  time.Time
+}
+
+type ImpersonationService struct {
+	DB *sql.DB
+	// Replica, opcional, atende a Events. A trilha pode aparecer com alguns
+	// segundos de atraso
+	Replica *sql.DB
+	// BytesPerToken is used to determine how many bytes to use when generating
+	// each impersonation token. If this value is not set or is less than the
+	// MinBytesPerToken const it will be ignored and MinBytesPerToken will be
+	// used.
+	BytesPerToken int
+	// Duration is the amount of time that an Impersonation is valid for.
+	// Defaults to DefaultImpersonationDuration
+	Duration time.Duration
+}
+
+// Start inicia a personificação. O evento AuditImpersonationStarted fica com
+// quem chama, que deve gravá-lo na mesma transação (veja InTx) junto com os
+// dados da requisição.
+func (is *ImpersonationService) Start(ctx context.Context, admin *User, userID int) (*Impersonation, error) {
+	if !admin.IsAdmin {
+		return nil, ErrNotAdmin
+	}
+	// não permite que um admin veja o sistema como outro admin, assim a
+	// personificação não pode ser usada para escalar privilégios
+	var targetIsAdmin bool
+	row := conn(ctx, is.DB).QueryRowContext(ctx, `
+		SELECT is_admin FROM users WHERE id = $1;`, userID)
+	err := row.Scan(&targetIsAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("start impersonation: %w", noRows(err, ErrNotFound))
+	}
+	if targetIsAdmin {
+		return nil, ErrImpersonateAdmin
+	}
+
+	bytesPerToken := is.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("start impersonation: %w", err)
+	}
+	duration := is.Duration
+	if duration == 0 {
+		duration = DefaultImpersonationDuration
+	}
+	now := time.Now()
+	imp := Impersonation{
+		AdminID:   admin.ID,
+		UserID:    userID,
+		Token:     token,
+		TokenHash: is.hash(token),
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	row = conn(ctx, is.DB).QueryRowContext(ctx, `
+		INSERT INTO impersonation_sessions (admin_id, user_id, token_hash, started_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id;`,
+		imp.AdminID, imp.UserID, imp.TokenHash, imp.StartedAt, imp.ExpiresAt)
+	err = row.Scan(&imp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("start impersonation: %w", err)
+	}
+	return &imp, nil
+}
+
+// User retorna o usuário alvo da personificação identificada pelo token. O
+// token só é válido quando usado pelo mesmo admin que iniciou a personificação.
+func (is *ImpersonationService) User(ctx context.Context, adminID int, token string) (*User, error) {
+	tokenHash := is.hash(token)
+	var user User
+	var expiresAt time.Time
+	row := conn(ctx, is.DB).QueryRowContext(ctx, `
+		SELECT impersonation_sessions.expires_at,
+			users.id,
+			users.email,
+			users.password_hash,
+			users.is_admin
+		FROM impersonation_sessions
+			JOIN users ON users.id = impersonation_sessions.user_id
+		WHERE impersonation_sessions.token_hash = $1
+			AND impersonation_sessions.admin_id = $2;`, tokenHash, adminID)
+	err := row.Scan(&expiresAt,
+		&user.ID, &user.Email, &user.PasswordHash, &user.IsAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("impersonated user: %w", noRows(err, ErrExpiredToken))
+	}
+	if time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("impersonated user: %w", ErrExpiredToken)
+	}
+	return &user, nil
+}
+
+// Stop encerra a personificação. Assim como em Start, o evento
+// AuditImpersonationStopped é gravado por quem chama.
+func (is *ImpersonationService) Stop(ctx context.Context, adminID int, token string) error {
+	res, err := conn(ctx, is.DB).ExecContext(ctx, `
+		DELETE FROM impersonation_sessions
+		WHERE token_hash = $1 AND admin_id = $2;`, is.hash(token), adminID)
+	if err != nil {
+		return fmt.Errorf("stop impersonation: %w", err)
+	}
+	return rowAffected(res, "stop impersonation")
+}
+
+// Events retorna os eventos de personificação mais recentes da trilha de
+// auditoria.
+func (is *ImpersonationService) Events(ctx context.Context, limit int) ([]ImpersonationEvent, error) {
+	rows, err := conn(ctx, reader(is.DB, is.Replica)).QueryContext(ctx, `
+		SELECT audit_events.id,
+			COALESCE(admins.email, ''),
+			COALESCE(users.email, ''),
+			audit_events.action,
+			audit_events.created_at
+		FROM audit_events
+			LEFT JOIN users admins ON admins.id = audit_events.actor_id
+			LEFT JOIN users ON users.id = audit_events.target_id
+		WHERE audit_events.action IN ($1, $2)
+		ORDER BY audit_events.created_at DESC
+		LIMIT $3;`, AuditImpersonationStarted, AuditImpersonationStopped, limit)
+	if err != nil {
+		return nil, fmt.Errorf("impersonation events: %w", err)
+	}
+	defer rows.Close()
+	var events []ImpersonationEvent
+	for rows.Next() {
+		var event ImpersonationEvent
+		var action string
+		err = rows.Scan(&event.ID, &event.AdminEmail, &event.UserEmail,
+			&action, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("impersonation events: %w", err)
+		}
+		event.Action = ImpersonationStarted
+		if action == AuditImpersonationStopped {
+			event.Action = ImpersonationStopped
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("impersonation events: %w", err)
+	}
+	return events, nil
+}
+
+func (is *ImpersonationService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
+
+// DeleteExpired remove as personificações que expiraram sem ser encerradas
+func (is *ImpersonationService) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := conn(ctx, is.DB).ExecContext(ctx, `
+		DELETE FROM impersonation_sessions
+		WHERE expires_at < $1;`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired impersonations: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired impersonations: %w", err)
+	}
+	return n, nil
+}
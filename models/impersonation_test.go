@@ -0,0 +1,152 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestImpersonationServiceStart(t *testing.T) {
+	f := newFixtures(t)
+	is := ImpersonationService{DB: f.db, Duration: 10 * time.Minute}
+	admin := f.admin()
+	user := f.user()
+
+	imp, err := is.Start(f.ctx, admin, user.ID)
+	if err != nil {
+		t.Fatalf("Start() err = %v", err)
+	}
+	if imp.AdminID != admin.ID || imp.UserID != user.ID || imp.Token == "" {
+		t.Errorf("Start() = %+v", imp)
+	}
+	assertNear(t, "ExpiresAt", imp.ExpiresAt, time.Now().Add(10*time.Minute))
+
+	_, err = is.Start(f.ctx, user, admin.ID)
+	if !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("Start() by a regular user err = %v, want %v", err, ErrNotAdmin)
+	}
+	_, err = is.Start(f.ctx, admin, f.admin().ID)
+	if !errors.Is(err, ErrImpersonateAdmin) {
+		t.Errorf("Start() on an admin err = %v, want %v", err, ErrImpersonateAdmin)
+	}
+}
+
+func TestImpersonationServiceUser(t *testing.T) {
+	f := newFixtures(t)
+	is := ImpersonationService{DB: f.db}
+	admin := f.admin()
+	user := f.user()
+	imp, err := is.Start(f.ctx, admin, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := is.User(f.ctx, admin.ID, imp.Token)
+	if err != nil {
+		t.Fatalf("User() err = %v", err)
+	}
+	if got.ID != user.ID || got.Email != user.Email {
+		t.Errorf("User() = %+v, want %+v", got, user)
+	}
+
+	// o token só vale para o admin que iniciou a personificação
+	_, err = is.User(f.ctx, f.admin().ID, imp.Token)
+	if err == nil {
+		t.Error("User() with another admin err = nil")
+	}
+
+	f.exec(`UPDATE impersonation_sessions SET expires_at = $2 WHERE id = $1;`,
+		imp.ID, time.Now().Add(-time.Minute))
+	_, err = is.User(f.ctx, admin.ID, imp.Token)
+	if err == nil {
+		t.Error("User() with an expired impersonation err = nil")
+	}
+}
+
+func TestImpersonationServiceStopAndEvents(t *testing.T) {
+	f := newFixtures(t)
+	is := ImpersonationService{DB: f.db}
+	as := AuditService{DB: f.db}
+	admin := f.admin()
+	user := f.user()
+	imp, err := is.Start(f.ctx, admin, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = is.Stop(f.ctx, f.admin().ID, imp.Token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stop() by another admin err = %v, want %v", err, ErrNotFound)
+	}
+	err = is.Stop(f.ctx, admin.ID, imp.Token)
+	if err != nil {
+		t.Fatalf("Stop() err = %v", err)
+	}
+	_, err = is.User(f.ctx, admin.ID, imp.Token)
+	if err == nil {
+		t.Error("User() after Stop() err = nil")
+	}
+
+	// a trilha é gravada por quem chama Start e Stop; outros eventos ficam de
+	// fora de Events
+	for _, action := range []string{AuditImpersonationStarted, AuditImpersonationStopped, AuditSignIn} {
+		err = as.Record(f.ctx, AuditEvent{ActorID: admin.ID, TargetID: user.ID, Action: action})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := is.Events(f.ctx, 10)
+	if err != nil {
+		t.Fatalf("Events() err = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Events() returned %d events, want 2", len(events))
+	}
+	actions := map[string]bool{}
+	for _, event := range events {
+		if event.AdminEmail != admin.Email || event.UserEmail != user.Email {
+			t.Errorf("event = %+v, want admin %q and user %q", event, admin.Email, user.Email)
+		}
+		actions[event.Action] = true
+	}
+	if !actions[ImpersonationStarted] || !actions[ImpersonationStopped] {
+		t.Errorf("Events() actions = %v, want start and stop", actions)
+	}
+
+	limited, err := is.Events(f.ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited) != 1 {
+		t.Errorf("Events(1) returned %d events", len(limited))
+	}
+}
+
+func TestImpersonationServiceDeleteExpired(t *testing.T) {
+	f := newFixtures(t)
+	is := ImpersonationService{DB: f.db}
+	admin := f.admin()
+	expired, err := is.Start(f.ctx, admin, f.user().ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := is.Start(f.ctx, admin, f.user().ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.exec(`UPDATE impersonation_sessions SET expires_at = $2 WHERE id = $1;`,
+		expired.ID, time.Now().Add(-time.Minute))
+
+	n, err := is.DeleteExpired(f.ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpired() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteExpired() = %d, want 1", n)
+	}
+	_, err = is.User(f.ctx, admin.ID, valid.Token)
+	if err != nil {
+		t.Errorf("valid impersonation was removed: %v", err)
+	}
+}
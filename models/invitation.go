@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/rand"
+)
+
+const (
+	// DefaultInvitationDuration is the default time that an Invitation is
+	// valid for.
+	DefaultInvitationDuration = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidInvitation = newError(ErrExpiredToken, "models: invitation is invalid or expired")
+	ErrInvitationPending = newError(ErrConflict, "models: email already has a pending invitation from another user")
+)
+
+type Invitation struct {
+	ID        int
+	Email     string
+	InvitedBy int
+	// Token is only set when an Invitation is being created.
+	Token     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type InvitationService struct {
+	DB *sql.DB
+	// BytesPerToken is used to determine how many bytes to use when generating
+	// each invitation token. If this value is not set or is less than the
+	// MinBytesPerToken const it will be ignored and MinBytesPerToken will be
+	// used.
+	BytesPerToken int
+	// Duration is the amount of time that an Invitation is valid for.
+	// Defaults to DefaultInvitationDuration
+	Duration time.Duration
+}
+
+// Create gera um convite para o email informado. Caso o email já tenha um
+// convite pendente do mesmo usuário, o token anterior deixa de ser válido. Um
+// convite pendente de outro usuário não é substituído: o link dele continuaria
+// no email da pessoa sem funcionar, então o erro é ErrInvitationPending.
+func (is *InvitationService) Create(ctx context.Context, email string, invitedBy int) (*Invitation, error) {
+	email = strings.ToLower(email)
+	var exists bool
+	row := conn(ctx, is.DB).QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE email = $1);`, email)
+	err := row.Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("create invitation: %w", err)
+	}
+	if exists {
+		return nil, ErrEmailTaken
+	}
+
+	bytesPerToken := is.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("create invitation: %w", err)
+	}
+	duration := is.Duration
+	if duration == 0 {
+		duration = DefaultInvitationDuration
+	}
+	now := time.Now()
+	invitation := Invitation{
+		Email:     email,
+		InvitedBy: invitedBy,
+		Token:     token,
+		TokenHash: is.hash(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	row = conn(ctx, is.DB).QueryRowContext(ctx, `
+		INSERT INTO invitations (email, invited_by, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (email) DO
+		UPDATE
+		SET invited_by = $2, token_hash = $3, created_at = $4, expires_at = $5
+		WHERE invitations.invited_by = $2 OR invitations.expires_at < $4
+		RETURNING id;`, invitation.Email, invitation.InvitedBy,
+		invitation.TokenHash, invitation.CreatedAt, invitation.ExpiresAt)
+	err = row.Scan(&invitation.ID)
+	if err != nil {
+		// sem linha o convite existente é de outra pessoa e ainda vale
+		return nil, noRows(fmt.Errorf("create invitation: %w", err), ErrInvitationPending)
+	}
+	return &invitation, nil
+}
+
+// ByToken retorna o convite caso o token seja válido e não tenha expirado.
+func (is *InvitationService) ByToken(ctx context.Context, token string) (*Invitation, error) {
+	invitation := Invitation{
+		TokenHash: is.hash(token),
+	}
+	row := conn(ctx, is.DB).QueryRowContext(ctx, `
+		SELECT id, email, invited_by, created_at, expires_at
+		FROM invitations
+		WHERE token_hash = $1;`, invitation.TokenHash)
+	err := row.Scan(&invitation.ID, &invitation.Email, &invitation.InvitedBy,
+		&invitation.CreatedAt, &invitation.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, fmt.Errorf("invitation by token: %w", err)
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+	return &invitation, nil
+}
+
+// Consume remove o convite para que o token não possa ser reutilizado.
+func (is *InvitationService) Consume(ctx context.Context, id int) error {
+	_, err := conn(ctx, is.DB).ExecContext(ctx, `
+		DELETE FROM invitations
+		WHERE id = $1;`, id)
+	if err != nil {
+		return fmt.Errorf("consume invitation: %w", err)
+	}
+	return nil
+}
+
+// ByInviter lista os convites pendentes enviados pelo usuário.
+func (is *InvitationService) ByInviter(ctx context.Context, userID int) ([]Invitation, error) {
+	rows, err := conn(ctx, is.DB).QueryContext(ctx, `
+		SELECT id, email, invited_by, created_at, expires_at
+		FROM invitations
+		WHERE invited_by = $1
+		ORDER BY created_at DESC;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("invitations by inviter: %w", err)
+	}
+	defer rows.Close()
+	var invitations []Invitation
+	for rows.Next() {
+		var invitation Invitation
+		err = rows.Scan(&invitation.ID, &invitation.Email, &invitation.InvitedBy,
+			&invitation.CreatedAt, &invitation.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invitations by inviter: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("invitations by inviter: %w", err)
+	}
+	return invitations, nil
+}
+
+func (is *InvitationService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
+
+// DeleteExpired remove os convites que expiraram sem ser aceitos
+func (is *InvitationService) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := conn(ctx, is.DB).ExecContext(ctx, `
+		DELETE FROM invitations
+		WHERE expires_at < $1;`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired invitations: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired invitations: %w", err)
+	}
+	return n, nil
+}
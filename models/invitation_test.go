@@ -0,0 +1,173 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInvitationServiceCreate(t *testing.T) {
+	f := newFixtures(t)
+	is := InvitationService{DB: f.db, Duration: time.Hour}
+	inviter := f.user()
+
+	invitation, err := is.Create(f.ctx, "New@Example.com", inviter.ID)
+	if err != nil {
+		t.Fatalf("Create() err = %v", err)
+	}
+	if invitation.Email != "new@example.com" || invitation.InvitedBy != inviter.ID || invitation.Token == "" {
+		t.Errorf("Create() = %+v", invitation)
+	}
+	assertNear(t, "ExpiresAt", invitation.ExpiresAt, time.Now().Add(time.Hour))
+
+	// convidar de novo substitui o token anterior
+	again, err := is.Create(f.ctx, "new@example.com", inviter.ID)
+	if err != nil {
+		t.Fatalf("second Create() err = %v", err)
+	}
+	if again.ID != invitation.ID {
+		t.Errorf("second Create() ID = %d, want the same row %d", again.ID, invitation.ID)
+	}
+	_, err = is.ByToken(f.ctx, invitation.Token)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("ByToken() with the replaced token err = %v, want %v", err, ErrInvalidInvitation)
+	}
+
+	_, err = is.Create(f.ctx, inviter.Email, inviter.ID)
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Create() for an existing user err = %v, want %v", err, ErrEmailTaken)
+	}
+}
+
+func TestInvitationServiceCreatePendingFromAnotherUser(t *testing.T) {
+	f := newFixtures(t)
+	is := InvitationService{DB: f.db}
+	inviter := f.user()
+	other := f.user()
+	invitation, err := is.Create(f.ctx, "new@example.com", inviter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = is.Create(f.ctx, "new@example.com", other.ID)
+	if !errors.Is(err, ErrInvitationPending) {
+		t.Fatalf("Create() by another user err = %v, want %v", err, ErrInvitationPending)
+	}
+	got, err := is.ByToken(f.ctx, invitation.Token)
+	if err != nil {
+		t.Fatalf("ByToken() with the first token err = %v", err)
+	}
+	if got.InvitedBy != inviter.ID {
+		t.Errorf("ByToken() InvitedBy = %d, want %d", got.InvitedBy, inviter.ID)
+	}
+
+	// um convite expirado pode ser substituído por qualquer um
+	f.exec(`UPDATE invitations SET expires_at = $2 WHERE id = $1;`,
+		invitation.ID, time.Now().Add(-time.Minute))
+	again, err := is.Create(f.ctx, "new@example.com", other.ID)
+	if err != nil {
+		t.Fatalf("Create() over an expired invitation err = %v", err)
+	}
+	if again.InvitedBy != other.ID {
+		t.Errorf("Create() InvitedBy = %d, want %d", again.InvitedBy, other.ID)
+	}
+}
+
+func TestInvitationServiceByTokenAndConsume(t *testing.T) {
+	f := newFixtures(t)
+	is := InvitationService{DB: f.db}
+	inviter := f.user()
+	invitation, err := is.Create(f.ctx, "new@example.com", inviter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := is.ByToken(f.ctx, invitation.Token)
+	if err != nil {
+		t.Fatalf("ByToken() err = %v", err)
+	}
+	if got.ID != invitation.ID || got.Email != invitation.Email || got.InvitedBy != inviter.ID {
+		t.Errorf("ByToken() = %+v, want %+v", got, invitation)
+	}
+
+	err = is.Consume(f.ctx, got.ID)
+	if err != nil {
+		t.Fatalf("Consume() err = %v", err)
+	}
+	_, err = is.ByToken(f.ctx, invitation.Token)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("ByToken() after Consume() err = %v, want %v", err, ErrInvalidInvitation)
+	}
+}
+
+func TestInvitationServiceByTokenExpired(t *testing.T) {
+	f := newFixtures(t)
+	is := InvitationService{DB: f.db}
+	invitation, err := is.Create(f.ctx, "new@example.com", f.user().ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.exec(`UPDATE invitations SET expires_at = $2 WHERE id = $1;`,
+		invitation.ID, time.Now().Add(-time.Minute))
+
+	_, err = is.ByToken(f.ctx, invitation.Token)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("ByToken() err = %v, want %v", err, ErrInvalidInvitation)
+	}
+}
+
+func TestInvitationServiceByInviter(t *testing.T) {
+	f := newFixtures(t)
+	is := InvitationService{DB: f.db}
+	inviter := f.user()
+	other := f.user()
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		_, err := is.Create(f.ctx, email, inviter.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := is.Create(f.ctx, "c@example.com", other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invitations, err := is.ByInviter(f.ctx, inviter.ID)
+	if err != nil {
+		t.Fatalf("ByInviter() err = %v", err)
+	}
+	if len(invitations) != 2 {
+		t.Fatalf("ByInviter() returned %d invitations, want 2", len(invitations))
+	}
+	if invitations[0].Email != "b@example.com" || invitations[1].Email != "a@example.com" {
+		t.Errorf("ByInviter() = %+v, want the newest first", invitations)
+	}
+}
+
+func TestInvitationServiceDeleteExpired(t *testing.T) {
+	f := newFixtures(t)
+	is := InvitationService{DB: f.db}
+	inviter := f.user()
+	expired, err := is.Create(f.ctx, "old@example.com", inviter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := is.Create(f.ctx, "new@example.com", inviter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.exec(`UPDATE invitations SET expires_at = $2 WHERE id = $1;`,
+		expired.ID, time.Now().Add(-time.Minute))
+
+	n, err := is.DeleteExpired(f.ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpired() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteExpired() = %d, want 1", n)
+	}
+	_, err = is.ByToken(f.ctx, valid.Token)
+	if err != nil {
+		t.Errorf("valid invitation was removed: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-mail/mail"
+	"github.com/vitoraalmeida/lenslocked/rand"
+)
+
+// Mailer é o transporte usado pelo EmailService para entregar os emails. Em
+// produção usamos o SMTPMailer; em desenvolvimento e nos testes os emails
+// podem ser gravados em arquivos (FileMailer) ou guardados em memória
+// (MemoryMailer), sem precisar de um servidor SMTP.
+type Mailer interface {
+	Send(email Email) error
+	Close() error
+}
+
+// MailerChecker é implementado pelos Mailers que conseguem verificar se o
+// transporte está disponível, usado pelo /readyz
+type MailerChecker interface {
+	Check(ctx context.Context) error
+}
+
+// Transportes disponíveis para a configuração da aplicação
+const (
+	MailTransportSMTP   = "smtp"
+	MailTransportFile   = "file"
+	MailTransportMemory = "memory"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// SMTPMailer entrega os emails por um servidor SMTP, reaprovetando conexões
+// entre os envios
+type SMTPMailer struct {
+	pool *smtpPool
+	addr string
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	dialer := mail.NewDialer(config.Host, config.Port, config.Username, config.Password)
+	return &SMTPMailer{
+		pool: newSMTPPool(dialer, DefaultSMTPPoolSize, DefaultSMTPIdleTimeout),
+		addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+	}
+}
+
+// Check abre uma conexão TCP com o servidor SMTP. Não faz o handshake SMTP
+// para não gastar o limite de conexões de provedores mais restritivos.
+func (sm *SMTPMailer) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", sm.addr)
+	if err != nil {
+		return fmt.Errorf("smtp check: %w", err)
+	}
+	return conn.Close()
+}
+
+func (sm *SMTPMailer) Send(email Email) error {
+	return sm.pool.Send(newMessage(email))
+}
+
+// Close encerra as conexões SMTP abertas
+func (sm *SMTPMailer) Close() error {
+	return sm.pool.Close()
+}
+
+// FileMailer grava cada email como um arquivo .eml num diretório no formato
+// maildir (tmp/, new/ e cur/), que pode ser aberto por clientes de email.
+type FileMailer struct {
+	Dir string
+}
+
+func (fm *FileMailer) Send(email Email) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(fm.Dir, sub), 0o755)
+		if err != nil {
+			return fmt.Errorf("file mailer: %w", err)
+		}
+	}
+	suffix, err := rand.String(6)
+	if err != nil {
+		return fmt.Errorf("file mailer: %w", err)
+	}
+	name := fmt.Sprintf("%d.%s.lenslocked.eml", time.Now().UnixNano(), suffix)
+	// o arquivo é escrito em tmp/ e depois movido para new/, assim quem lê o
+	// diretório nunca encontra um email pela metade
+	tmpPath := filepath.Join(fm.Dir, "tmp", name)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("file mailer: %w", err)
+	}
+	_, err = newMessage(email).WriteTo(f)
+	if err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("file mailer: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("file mailer: %w", err)
+	}
+	err = os.Rename(tmpPath, filepath.Join(fm.Dir, "new", name))
+	if err != nil {
+		return fmt.Errorf("file mailer: %w", err)
+	}
+	return nil
+}
+
+func (fm *FileMailer) Close() error {
+	return nil
+}
+
+// Check verifica se é possível escrever no diretório
+func (fm *FileMailer) Check(ctx context.Context) error {
+	dir := filepath.Join(fm.Dir, "tmp")
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("file mailer check: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "check-*")
+	if err != nil {
+		return fmt.Errorf("file mailer check: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// DefaultMemoryMailerLimit is the default number of messages kept by a
+// MemoryMailer. Older messages are discarded first.
+const DefaultMemoryMailerLimit = 100
+
+// CapturedEmail é um email guardado pelo MemoryMailer
+type CapturedEmail struct {
+	ID int
+	Email
+	SentAt time.Time
+}
+
+// MemoryMailer guarda os emails enviados em memória. É seguro para uso
+// concorrente.
+type MemoryMailer struct {
+	// Limit defaults to DefaultMemoryMailerLimit
+	Limit int
+
+	mu     sync.Mutex
+	nextID int
+	emails []CapturedEmail
+}
+
+func (mm *MemoryMailer) Send(email Email) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	limit := mm.Limit
+	if limit <= 0 {
+		limit = DefaultMemoryMailerLimit
+	}
+	mm.nextID++
+	mm.emails = append(mm.emails, CapturedEmail{
+		ID:     mm.nextID,
+		Email:  email,
+		SentAt: time.Now(),
+	})
+	if len(mm.emails) > limit {
+		mm.emails = mm.emails[len(mm.emails)-limit:]
+	}
+	return nil
+}
+
+func (mm *MemoryMailer) Close() error {
+	return nil
+}
+
+// Emails retorna uma cópia dos emails guardados, do mais recente para o mais
+// antigo
+func (mm *MemoryMailer) Emails() []CapturedEmail {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	emails := make([]CapturedEmail, len(mm.emails))
+	for i, email := range mm.emails {
+		emails[len(emails)-1-i] = email
+	}
+	return emails
+}
+
+func (mm *MemoryMailer) Email(id int) (CapturedEmail, bool) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	for _, email := range mm.emails {
+		if email.ID == id {
+			return email, true
+		}
+	}
+	return CapturedEmail{}, false
+}
+
+// Reset descarta todos os emails guardados
+func (mm *MemoryMailer) Reset() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.emails = nil
+}
+
+// newMessage monta a mensagem MIME com a versão em texto e/ou HTML
+func newMessage(email Email) *mail.Message {
+	msg := mail.NewMessage()
+	msg.SetHeader("To", email.To)
+	msg.SetHeader("From", email.From)
+	msg.SetHeader("Subject", email.Subject)
+	switch {
+	case email.Plaintext != "" && email.HTML != "":
+		msg.SetBody("text/plain", email.Plaintext)
+		msg.AddAlternative("text/html", email.HTML)
+	case email.Plaintext != "":
+		msg.SetBody("text/plain", email.Plaintext)
+	case email.HTML != "":
+		msg.SetBody("text/html", email.HTML)
+	}
+	return msg
+}
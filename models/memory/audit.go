@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+type AuditService struct {
+	Store *Store
+}
+
+func (as *AuditService) Record(ctx context.Context, event models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.Email = strings.ToLower(event.Email)
+	as.Store.mu.Lock()
+	defer as.Store.mu.Unlock()
+	event.ID = as.Store.id()
+	as.Store.events = append(as.Store.events, event)
+	return nil
+}
+
+// ForUser retorna os eventos do mais recente para o mais antigo. Um limit
+// menor ou igual a zero retorna todos os eventos.
+func (as *AuditService) ForUser(ctx context.Context, user *models.User, limit int) ([]models.AuditEvent, error) {
+	as.Store.mu.Lock()
+	defer as.Store.mu.Unlock()
+	var events []models.AuditEvent
+	for i := len(as.Store.events) - 1; i >= 0; i-- {
+		event := as.Store.events[i]
+		if event.ActorID != user.ID && event.TargetID != user.ID && event.Email != user.Email {
+			continue
+		}
+		events = append(events, event)
+		if limit > 0 && len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// Events retorna todos os eventos registrados, na ordem em que foram
+// registrados
+func (as *AuditService) Events() []models.AuditEvent {
+	as.Store.mu.Lock()
+	defer as.Store.mu.Unlock()
+	events := make([]models.AuditEvent, len(as.Store.events))
+	copy(events, as.Store.events)
+	return events
+}
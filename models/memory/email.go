@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+// SentEmail é um email pedido ao EmailService. Apenas os campos do tipo de
+// email correspondente são preenchidos.
+type SentEmail struct {
+	// Kind é o nome do template, como forgot-password
+	Kind string
+	To   string
+	URL  string
+	// Alert é preenchido nos alertas de segurança
+	Alert models.SecurityAlert
+}
+
+// EmailService guarda os emails em vez de renderizar e enviar. Não depende
+// do Store.
+type EmailService struct {
+	mu     sync.Mutex
+	emails []SentEmail
+}
+
+func (es *EmailService) ForgotPassword(ctx context.Context, to, resetURL string) error {
+	es.record(SentEmail{Kind: "forgot-password", To: to, URL: resetURL})
+	return nil
+}
+
+func (es *EmailService) SecurityAlert(ctx context.Context, to string, alert models.SecurityAlert) error {
+	es.record(SentEmail{Kind: "security-alert", To: to, Alert: alert})
+	return nil
+}
+
+// Emails retorna uma cópia dos emails, na ordem em que foram pedidos
+func (es *EmailService) Emails() []SentEmail {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	emails := make([]SentEmail, len(es.emails))
+	copy(emails, es.emails)
+	return emails
+}
+
+func (es *EmailService) record(email SentEmail) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.emails = append(es.emails, email)
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportService gera um ZIP com o mesmo profile.json do models.ExportService,
+// sem o histórico de atividade
+type ExportService struct {
+	Store *Store
+}
+
+func (es *ExportService) Write(ctx context.Context, w io.Writer, userID int) error {
+	es.Store.mu.Lock()
+	user, err := es.Store.user("export", userID)
+	es.Store.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("profile.json")
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	err = json.NewEncoder(f).Encode(map[string]interface{}{
+		"id":       user.ID,
+		"email":    user.Email,
+		"is_admin": user.IsAdmin,
+	})
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+type ImpersonationService struct {
+	Store *Store
+	// Duration defaults to models.DefaultImpersonationDuration
+	Duration time.Duration
+}
+
+func (is *ImpersonationService) Start(ctx context.Context, admin *models.User, userID int) (*models.Impersonation, error) {
+	if !admin.IsAdmin {
+		return nil, models.ErrNotAdmin
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("start impersonation: %w", err)
+	}
+	duration := is.Duration
+	if duration == 0 {
+		duration = models.DefaultImpersonationDuration
+	}
+	is.Store.mu.Lock()
+	defer is.Store.mu.Unlock()
+	user, err := is.Store.user("start impersonation", userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsAdmin {
+		return nil, models.ErrImpersonateAdmin
+	}
+	now := time.Now()
+	imp := models.Impersonation{
+		ID:        is.Store.id(),
+		AdminID:   admin.ID,
+		UserID:    userID,
+		Token:     token,
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	is.Store.impersonations[token] = imp
+	return &imp, nil
+}
+
+func (is *ImpersonationService) User(ctx context.Context, adminID int, token string) (*models.User, error) {
+	is.Store.mu.Lock()
+	defer is.Store.mu.Unlock()
+	imp, ok := is.Store.impersonations[token]
+	if !ok || imp.AdminID != adminID {
+		return nil, fmt.Errorf("impersonated user: %w", models.ErrExpiredToken)
+	}
+	if expired(imp.ExpiresAt) {
+		return nil, fmt.Errorf("impersonated user: %w", models.ErrExpiredToken)
+	}
+	return is.Store.user("impersonated user", imp.UserID)
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+type InvitationService struct {
+	Store *Store
+	// Duration defaults to models.DefaultInvitationDuration
+	Duration time.Duration
+}
+
+// Create gera um convite para o email informado, invalidando o anterior do
+// mesmo usuário. Um convite pendente de outro usuário resulta em
+// models.ErrInvitationPending
+func (is *InvitationService) Create(ctx context.Context, email string, invitedBy int) (*models.Invitation, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("create invitation: %w", err)
+	}
+	duration := is.Duration
+	if duration == 0 {
+		duration = models.DefaultInvitationDuration
+	}
+	email = strings.ToLower(email)
+	is.Store.mu.Lock()
+	defer is.Store.mu.Unlock()
+	for t, invitation := range is.Store.invitations {
+		if invitation.Email != email {
+			continue
+		}
+		if invitation.InvitedBy != invitedBy && !expired(invitation.ExpiresAt) {
+			return nil, models.ErrInvitationPending
+		}
+		delete(is.Store.invitations, t)
+	}
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        is.Store.id(),
+		Email:     email,
+		InvitedBy: invitedBy,
+		Token:     token,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	is.Store.invitations[token] = invitation
+	return &invitation, nil
+}
+
+func (is *InvitationService) ByToken(ctx context.Context, token string) (*models.Invitation, error) {
+	is.Store.mu.Lock()
+	defer is.Store.mu.Unlock()
+	invitation, ok := is.Store.invitations[token]
+	if !ok || expired(invitation.ExpiresAt) {
+		return nil, models.ErrInvalidInvitation
+	}
+	return &invitation, nil
+}
+
+func (is *InvitationService) Consume(ctx context.Context, id int) error {
+	is.Store.mu.Lock()
+	defer is.Store.mu.Unlock()
+	for t, invitation := range is.Store.invitations {
+		if invitation.ID == id {
+			delete(is.Store.invitations, t)
+		}
+	}
+	return nil
+}
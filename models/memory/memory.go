@@ -0,0 +1,73 @@
+// Package memory implementa em memória os serviços usados pelos controllers,
+// para que os handlers possam ser testados com httptest sem um Postgres.
+//
+// Os serviços criados a partir do mesmo Store compartilham os dados, assim
+// como os serviços do pacote models compartilham o banco: uma sessão criada
+// pelo SessionService retorna o usuário criado pelo UserService. Todos são
+// seguros para uso concorrente.
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/rand"
+)
+
+type Store struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]models.User
+	// sessões e tokens guardam o token original, já que não há banco para
+	// vazar
+	sessions       map[string]int
+	passwordResets map[string]models.PasswordReset
+	invitations    map[string]models.Invitation
+	impersonations map[string]models.Impersonation
+	events         []models.AuditEvent
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:          make(map[int]models.User),
+		sessions:       make(map[string]int),
+		passwordResets: make(map[string]models.PasswordReset),
+		invitations:    make(map[string]models.Invitation),
+		impersonations: make(map[string]models.Impersonation),
+	}
+}
+
+// id retorna o próximo id. Deve ser chamado com o lock
+func (s *Store) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+// user busca o usuário pelo id. Deve ser chamado com o lock
+func (s *Store) user(op string, id int) (*models.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrNotFound)
+	}
+	return &user, nil
+}
+
+// userByEmail deve ser chamado com o lock
+func (s *Store) userByEmail(op, email string) (*models.User, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", op, models.ErrNotFound)
+}
+
+func newToken() (string, error) {
+	return rand.String(models.MinBytesPerToken)
+}
+
+func expired(t time.Time) bool {
+	return time.Now().After(t)
+}
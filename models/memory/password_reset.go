@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+type PasswordResetService struct {
+	Store *Store
+	// Duration defaults to models.DefaultResetDuration
+	Duration time.Duration
+}
+
+func (service *PasswordResetService) Create(ctx context.Context, email string) (*models.PasswordReset, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("create: %w", err)
+	}
+	duration := service.Duration
+	if duration == 0 {
+		duration = models.DefaultResetDuration
+	}
+	service.Store.mu.Lock()
+	defer service.Store.mu.Unlock()
+	user, err := service.Store.userByEmail("create", strings.ToLower(email))
+	if err != nil {
+		return nil, err
+	}
+	// cada usuário tem no máximo um reset pendente
+	for t, pwReset := range service.Store.passwordResets {
+		if pwReset.UserID == user.ID {
+			delete(service.Store.passwordResets, t)
+		}
+	}
+	pwReset := models.PasswordReset{
+		ID:        service.Store.id(),
+		UserID:    user.ID,
+		Token:     token,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	service.Store.passwordResets[token] = pwReset
+	return &pwReset, nil
+}
+
+func (service *PasswordResetService) Consume(ctx context.Context, token string) (*models.User, error) {
+	service.Store.mu.Lock()
+	defer service.Store.mu.Unlock()
+	pwReset, ok := service.Store.passwordResets[token]
+	if !ok {
+		return nil, fmt.Errorf("consume: %w", models.ErrExpiredToken)
+	}
+	if expired(pwReset.ExpiresAt) {
+		return nil, fmt.Errorf("consume: %w", models.ErrExpiredToken)
+	}
+	delete(service.Store.passwordResets, token)
+	return service.Store.user("consume", pwReset.UserID)
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+)
+
+type SessionService struct {
+	Store *Store
+}
+
+// Create substitui a sessão anterior do usuário, já que cada usuário tem no
+// máximo uma sessão
+func (ss *SessionService) Create(ctx context.Context, userID int) (*models.Session, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("create: %w", err)
+	}
+	ss.Store.mu.Lock()
+	defer ss.Store.mu.Unlock()
+	for t, id := range ss.Store.sessions {
+		if id == userID {
+			delete(ss.Store.sessions, t)
+		}
+	}
+	ss.Store.sessions[token] = userID
+	return &models.Session{
+		ID:     ss.Store.id(),
+		UserID: userID,
+		Token:  token,
+	}, nil
+}
+
+func (ss *SessionService) User(ctx context.Context, token string) (*models.User, error) {
+	ss.Store.mu.Lock()
+	defer ss.Store.mu.Unlock()
+	userID, ok := ss.Store.sessions[token]
+	if !ok {
+		return nil, fmt.Errorf("user: %w", models.ErrNotFound)
+	}
+	return ss.Store.user("user", userID)
+}
+
+func (ss *SessionService) Delete(ctx context.Context, token string) error {
+	ss.Store.mu.Lock()
+	defer ss.Store.mu.Unlock()
+	delete(ss.Store.sessions, token)
+	return nil
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+// Transactor imita models.Transactor: as alterações feitas no Store por fn são
+// desfeitas quando ela retorna um erro. Diferente do banco, não isola fn de
+// outras goroutines usando o mesmo Store.
+type Transactor struct {
+	Store *Store
+}
+
+func (t *Transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	snapshot := t.Store.snapshot()
+	err := fn(ctx)
+	if err != nil {
+		t.Store.restore(snapshot)
+	}
+	return err
+}
+
+// snapshot copia os dados do Store
+func (s *Store) snapshot() *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &Store{
+		nextID:         s.nextID,
+		users:          maps.Clone(s.users),
+		sessions:       maps.Clone(s.sessions),
+		passwordResets: maps.Clone(s.passwordResets),
+		invitations:    maps.Clone(s.invitations),
+		impersonations: maps.Clone(s.impersonations),
+		events:         slices.Clone(s.events),
+	}
+}
+
+// restore volta os dados do Store para os de um snapshot
+func (s *Store) restore(snapshot *Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID = snapshot.nextID
+	s.users = snapshot.users
+	s.sessions = snapshot.sessions
+	s.passwordResets = snapshot.passwordResets
+	s.invitations = snapshot.invitations
+	s.impersonations = snapshot.impersonations
+	s.events = snapshot.events
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserService struct {
+	Store *Store
+	// DeletionGracePeriod defaults to models.DefaultDeletionGracePeriod
+	DeletionGracePeriod time.Duration
+}
+
+func (us *UserService) Create(ctx context.Context, email, password string) (*models.User, error) {
+	email = strings.ToLower(email)
+	// o custo mínimo deixa os testes rápidos; a comparação continua sendo a
+	// mesma do UserService de verdade
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	if _, err := us.Store.userByEmail("create user", email); err == nil {
+		return nil, models.ErrEmailTaken
+	}
+	user := models.User{
+		ID:           us.Store.id(),
+		Email:        email,
+		PasswordHash: string(hash),
+	}
+	us.Store.users[user.ID] = user
+	return &user, nil
+}
+
+func (us *UserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	us.Store.mu.Lock()
+	user, err := us.Store.userByEmail("authenticate", strings.ToLower(email))
+	us.Store.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: %w", models.ErrInvalidCredentials)
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return nil, fmt.Errorf("authenticate: %w", models.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: %w", err)
+	}
+	return user, nil
+}
+
+func (us *UserService) UpdatePassword(ctx context.Context, userID int, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	user, err := us.Store.user("update password", userID)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	us.Store.users[userID] = *user
+	return nil
+}
+
+func (us *UserService) ByID(ctx context.Context, id int) (*models.User, error) {
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	return us.Store.user("by id", id)
+}
+
+func (us *UserService) ByEmail(ctx context.Context, email string) (*models.User, error) {
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	return us.Store.userByEmail("by email", strings.ToLower(email))
+}
+
+func (us *UserService) SetAdmin(ctx context.Context, userID int, isAdmin bool) error {
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	user, err := us.Store.user("set admin", userID)
+	if err != nil {
+		return err
+	}
+	user.IsAdmin = isAdmin
+	us.Store.users[userID] = *user
+	return nil
+}
+
+// ScheduleDeletion também encerra as sessões do usuário, como no
+// models.UserService
+func (us *UserService) ScheduleDeletion(ctx context.Context, userID int) (time.Time, error) {
+	gracePeriod := us.DeletionGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = models.DefaultDeletionGracePeriod
+	}
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	user, err := us.Store.user("schedule deletion", userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	user.DeletionScheduledAt = time.Now().Add(gracePeriod)
+	us.Store.users[userID] = *user
+	for token, id := range us.Store.sessions {
+		if id == userID {
+			delete(us.Store.sessions, token)
+		}
+	}
+	return user.DeletionScheduledAt, nil
+}
+
+func (us *UserService) CancelDeletion(ctx context.Context, userID int) error {
+	us.Store.mu.Lock()
+	defer us.Store.mu.Unlock()
+	user, err := us.Store.user("cancel deletion", userID)
+	if err != nil {
+		return err
+	}
+	user.DeletionScheduledAt = time.Time{}
+	us.Store.users[userID] = *user
+	return nil
+}
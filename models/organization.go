@@ -0,0 +1,435 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vitoraalmeida/lenslocked/rand"
+)
+
+// Papéis de um membro dentro de uma organização
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var (
+	ErrInvalidRole = errors.New("models: invalid organization role")
+	// uma organização precisa ter pelo menos um owner
+	ErrLastOwner = newError(ErrConflict, "models: organization must have at least one owner")
+)
+
+func ValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleEditor, RoleViewer:
+		return true
+	}
+	return false
+}
+
+type Organization struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+	// Role do usuário que fez a consulta. Preenchido apenas por ForUser
+	Role string
+}
+
+type Member struct {
+	UserID int
+	Email  string
+	Role   string
+}
+
+type OrganizationInvitation struct {
+	ID             int
+	OrganizationID int
+	Email          string
+	Role           string
+	InvitedBy      int
+	// Token is only set when an OrganizationInvitation is being created.
+	Token     string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type OrganizationService struct {
+	DB *sql.DB
+	// BytesPerToken is used to determine how many bytes to use when generating
+	// each invitation token. If this value is not set or is less than the
+	// MinBytesPerToken const it will be ignored and MinBytesPerToken will be
+	// used.
+	BytesPerToken int
+	// InvitationDuration is the amount of time that an invitation is valid
+	// for. Defaults to DefaultInvitationDuration
+	InvitationDuration time.Duration
+}
+
+// Create cria a organização tendo o usuário informado como owner
+func (service *OrganizationService) Create(ctx context.Context, name string, ownerID int) (*Organization, error) {
+	org := Organization{
+		Name:      strings.TrimSpace(name),
+		CreatedAt: time.Now(),
+		Role:      RoleOwner,
+	}
+	// sem o owner a organização ficaria inacessível
+	err := InTx(ctx, service.DB, func(ctx context.Context) error {
+		row := conn(ctx, service.DB).QueryRowContext(ctx, `
+			INSERT INTO organizations (name, created_at)
+			VALUES ($1, $2) RETURNING id;`, org.Name, org.CreatedAt)
+		err := row.Scan(&org.ID)
+		if err != nil {
+			return err
+		}
+		return service.addMember(ctx, org.ID, ownerID, RoleOwner)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create organization: %w", err)
+	}
+	return &org, nil
+}
+
+func (service *OrganizationService) ByID(ctx context.Context, id int) (*Organization, error) {
+	org := Organization{
+		ID: id,
+	}
+	row := conn(ctx, service.DB).QueryRowContext(ctx, `
+		SELECT name, created_at
+		FROM organizations
+		WHERE id = $1;`, id)
+	err := row.Scan(&org.Name, &org.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("organization by id: %w", noRows(err, ErrNotFound))
+	}
+	return &org, nil
+}
+
+// ForUser lista as organizações das quais o usuário é membro, junto com o seu
+// papel em cada uma
+func (service *OrganizationService) ForUser(ctx context.Context, userID int) ([]Organization, error) {
+	rows, err := conn(ctx, service.DB).QueryContext(ctx, `
+		SELECT organizations.id,
+			organizations.name,
+			organizations.created_at,
+			organization_members.role
+		FROM organizations
+			JOIN organization_members ON organization_members.organization_id = organizations.id
+		WHERE organization_members.user_id = $1
+		ORDER BY organizations.name;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("organizations for user: %w", err)
+	}
+	defer rows.Close()
+	var orgs []Organization
+	for rows.Next() {
+		var org Organization
+		err = rows.Scan(&org.ID, &org.Name, &org.CreatedAt, &org.Role)
+		if err != nil {
+			return nil, fmt.Errorf("organizations for user: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("organizations for user: %w", err)
+	}
+	return orgs, nil
+}
+
+func (service *OrganizationService) Members(ctx context.Context, orgID int) ([]Member, error) {
+	rows, err := conn(ctx, service.DB).QueryContext(ctx, `
+		SELECT users.id, users.email, organization_members.role
+		FROM organization_members
+			JOIN users ON users.id = organization_members.user_id
+		WHERE organization_members.organization_id = $1
+		ORDER BY users.email;`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("organization members: %w", err)
+	}
+	defer rows.Close()
+	var members []Member
+	for rows.Next() {
+		var member Member
+		err = rows.Scan(&member.UserID, &member.Email, &member.Role)
+		if err != nil {
+			return nil, fmt.Errorf("organization members: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("organization members: %w", err)
+	}
+	return members, nil
+}
+
+func (service *OrganizationService) SetRole(ctx context.Context, orgID, userID int, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	// a verificação do último owner e a alteração precisam ver o mesmo estado
+	return InTx(ctx, service.DB, func(ctx context.Context) error {
+		if role != RoleOwner {
+			err := service.ensureAnotherOwner(ctx, orgID, userID)
+			if err != nil {
+				return fmt.Errorf("set role: %w", err)
+			}
+		}
+		res, err := conn(ctx, service.DB).ExecContext(ctx, `
+			UPDATE organization_members
+			SET role = $3
+			WHERE organization_id = $1 AND user_id = $2;`, orgID, userID, role)
+		if err != nil {
+			return fmt.Errorf("set role: %w", err)
+		}
+		return rowAffected(res, "set role")
+	})
+}
+
+func (service *OrganizationService) RemoveMember(ctx context.Context, orgID, userID int) error {
+	return InTx(ctx, service.DB, func(ctx context.Context) error {
+		err := service.ensureAnotherOwner(ctx, orgID, userID)
+		if err != nil {
+			return fmt.Errorf("remove member: %w", err)
+		}
+		res, err := conn(ctx, service.DB).ExecContext(ctx, `
+			DELETE FROM organization_members
+			WHERE organization_id = $1 AND user_id = $2;`, orgID, userID)
+		if err != nil {
+			return fmt.Errorf("remove member: %w", err)
+		}
+		return rowAffected(res, "remove member")
+	})
+}
+
+// Invite cria um convite para que o email informado entre na organização com
+// o papel indicado. Convidar o mesmo email novamente substitui o convite
+// anterior.
+func (service *OrganizationService) Invite(ctx context.Context, orgID int, email, role string, invitedBy int) (*OrganizationInvitation, error) {
+	if !ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	bytesPerToken := service.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("invite member: %w", err)
+	}
+	duration := service.InvitationDuration
+	if duration == 0 {
+		duration = DefaultInvitationDuration
+	}
+	invitation := OrganizationInvitation{
+		OrganizationID: orgID,
+		Email:          strings.ToLower(email),
+		Role:           role,
+		InvitedBy:      invitedBy,
+		Token:          token,
+		TokenHash:      service.hash(token),
+		ExpiresAt:      time.Now().Add(duration),
+	}
+	row := conn(ctx, service.DB).QueryRowContext(ctx, `
+		INSERT INTO organization_invitations (organization_id, email, role, invited_by, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (organization_id, email) DO
+		UPDATE
+		SET role = $3, invited_by = $4, token_hash = $5, expires_at = $6
+		RETURNING id;`, invitation.OrganizationID, invitation.Email, invitation.Role,
+		invitation.InvitedBy, invitation.TokenHash, invitation.ExpiresAt)
+	err = row.Scan(&invitation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invite member: %w", err)
+	}
+	return &invitation, nil
+}
+
+// Invitation retorna o convite caso o token seja válido e não tenha expirado.
+func (service *OrganizationService) Invitation(ctx context.Context, token string) (*OrganizationInvitation, error) {
+	invitation := OrganizationInvitation{
+		TokenHash: service.hash(token),
+	}
+	row := conn(ctx, service.DB).QueryRowContext(ctx, `
+		SELECT id, organization_id, email, role, invited_by, expires_at
+		FROM organization_invitations
+		WHERE token_hash = $1;`, invitation.TokenHash)
+	err := row.Scan(&invitation.ID, &invitation.OrganizationID, &invitation.Email,
+		&invitation.Role, &invitation.InvitedBy, &invitation.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, fmt.Errorf("organization invitation: %w", err)
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+	return &invitation, nil
+}
+
+// AcceptInvitation adiciona o usuário à organização do convite. O convite só
+// pode ser aceito pelo usuário com o email convidado.
+func (service *OrganizationService) AcceptInvitation(ctx context.Context, token string, user *User) (*Organization, error) {
+	invitation, err := service.Invitation(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("accept invitation: %w", err)
+	}
+	if invitation.Email != strings.ToLower(user.Email) {
+		return nil, ErrInvalidInvitation
+	}
+	err = InTx(ctx, service.DB, func(ctx context.Context) error {
+		_, err := conn(ctx, service.DB).ExecContext(ctx, `
+			INSERT INTO organization_members (organization_id, user_id, role, created_at)
+			VALUES ($1, $2, $3, $4) ON CONFLICT (organization_id, user_id) DO
+			UPDATE
+			SET role = $3;`, invitation.OrganizationID, user.ID, invitation.Role, time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = conn(ctx, service.DB).ExecContext(ctx, `
+			DELETE FROM organization_invitations
+			WHERE id = $1;`, invitation.ID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("accept invitation: %w", err)
+	}
+	return service.ByID(ctx, invitation.OrganizationID)
+}
+
+func (service *OrganizationService) addMember(ctx context.Context, orgID, userID int, role string) error {
+	_, err := conn(ctx, service.DB).ExecContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4);`, orgID, userID, role, time.Now())
+	if err != nil {
+		return fmt.Errorf("add member: %w", err)
+	}
+	return nil
+}
+
+// retorna ErrLastOwner caso o usuário seja o único owner da organização,
+// impedindo que ela fique sem ninguém para gerenciá-la. Precisa rodar dentro
+// de uma transação: as linhas dos owners ficam travadas até o fim dela, assim
+// dois owners não conseguem rebaixar um ao outro ao mesmo tempo
+func (service *OrganizationService) ensureAnotherOwner(ctx context.Context, orgID, userID int) error {
+	rows, err := conn(ctx, service.DB).QueryContext(ctx, `
+		SELECT user_id
+		FROM organization_members
+		WHERE organization_id = $1 AND role = $2
+		FOR UPDATE;`, orgID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var owner bool
+	var others int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return err
+		}
+		if id == userID {
+			owner = true
+		} else {
+			others++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if owner && others == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// rowAffected retorna ErrNotFound quando a alteração não encontrou o membro
+func rowAffected(res sql.Result, op string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	return nil
+}
+
+// ownedAlone retorna as organizações em que o usuário é o único membro, que
+// são apagadas junto com a conta dele. Se ele for o único owner de uma
+// organização com outros membros retorna ErrLastOwner: alguém precisa ser
+// promovido antes. Como ensureAnotherOwner, trava as linhas dos owners.
+func (service *OrganizationService) ownedAlone(ctx context.Context, userID int) ([]int, error) {
+	rows, err := conn(ctx, service.DB).QueryContext(ctx, `
+		SELECT organization_id
+		FROM organization_members
+		WHERE user_id = $1 AND role = $2;`, userID, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	var owned []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owned = append(owned, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var alone []int
+	for _, orgID := range owned {
+		err := service.ensureAnotherOwner(ctx, orgID, userID)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrLastOwner) {
+			return nil, err
+		}
+		var members int
+		row := conn(ctx, service.DB).QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM organization_members
+			WHERE organization_id = $1;`, orgID)
+		err = row.Scan(&members)
+		if err != nil {
+			return nil, err
+		}
+		if members > 1 {
+			return nil, ErrLastOwner
+		}
+		alone = append(alone, orgID)
+	}
+	return alone, nil
+}
+
+func (service *OrganizationService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
+
+// DeleteExpiredInvitations remove os convites para organizações que
+// expiraram sem ser aceitos
+func (service *OrganizationService) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	res, err := conn(ctx, service.DB).ExecContext(ctx, `
+		DELETE FROM organization_invitations
+		WHERE expires_at < $1;`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired organization invitations: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired organization invitations: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrganizationServiceCreate(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db}
+	owner := f.user()
+
+	org, err := service.Create(f.ctx, "  Acme  ", owner.ID)
+	if err != nil {
+		t.Fatalf("Create() err = %v", err)
+	}
+	if org.Name != "Acme" || org.Role != RoleOwner {
+		t.Errorf("Create() = %+v", org)
+	}
+	got, err := service.ByID(f.ctx, org.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %v", err)
+	}
+	if got.Name != "Acme" {
+		t.Errorf("ByID() Name = %q", got.Name)
+	}
+	_, err = service.ByID(f.ctx, org.ID+100)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByID() unknown err = %v, want %v", err, ErrNotFound)
+	}
+
+	members, err := service.Members(f.ctx, org.ID)
+	if err != nil {
+		t.Fatalf("Members() err = %v", err)
+	}
+	if len(members) != 1 || members[0].UserID != owner.ID || members[0].Role != RoleOwner {
+		t.Errorf("Members() = %+v, want only the owner", members)
+	}
+}
+
+func TestOrganizationServiceForUser(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db}
+	user := f.user()
+	other := f.user()
+	for _, name := range []string{"Zeta", "Alpha"} {
+		_, err := service.Create(f.ctx, name, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := service.Create(f.ctx, "Other", other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orgs, err := service.ForUser(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ForUser() err = %v", err)
+	}
+	if len(orgs) != 2 || orgs[0].Name != "Alpha" || orgs[1].Name != "Zeta" {
+		t.Errorf("ForUser() = %+v, want Alpha and Zeta", orgs)
+	}
+	for _, org := range orgs {
+		if org.Role != RoleOwner {
+			t.Errorf("%s role = %q, want %q", org.Name, org.Role, RoleOwner)
+		}
+	}
+}
+
+// newOrganization cria uma organização com um owner e um viewer
+func newOrganization(f *fixtures) (org *Organization, owner, viewer *User) {
+	f.t.Helper()
+	service := OrganizationService{DB: f.db}
+	owner = f.user()
+	viewer = f.user()
+	org, err := service.Create(f.ctx, "Acme", owner.ID)
+	if err != nil {
+		f.t.Fatalf("create organization fixture: %v", err)
+	}
+	err = service.addMember(f.ctx, org.ID, viewer.ID, RoleViewer)
+	if err != nil {
+		f.t.Fatalf("create organization fixture: %v", err)
+	}
+	return org, owner, viewer
+}
+
+func TestOrganizationServiceSetRole(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db}
+	org, owner, viewer := newOrganization(f)
+
+	err := service.SetRole(f.ctx, org.ID, viewer.ID, "boss")
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("SetRole() with an invalid role err = %v, want %v", err, ErrInvalidRole)
+	}
+	stranger := f.user()
+	err = service.SetRole(f.ctx, org.ID, stranger.ID, RoleEditor)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetRole() for a non-member err = %v, want %v", err, ErrNotFound)
+	}
+	err = service.SetRole(f.ctx, org.ID, owner.ID, RoleEditor)
+	if !errors.Is(err, ErrLastOwner) {
+		t.Errorf("SetRole() on the last owner err = %v, want %v", err, ErrLastOwner)
+	}
+
+	err = service.SetRole(f.ctx, org.ID, viewer.ID, RoleOwner)
+	if err != nil {
+		t.Fatalf("SetRole() err = %v", err)
+	}
+	// com outro owner o primeiro pode deixar de sê-lo
+	err = service.SetRole(f.ctx, org.ID, owner.ID, RoleEditor)
+	if err != nil {
+		t.Fatalf("SetRole() with another owner err = %v", err)
+	}
+	orgs, err := service.ForUser(f.ctx, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0].Role != RoleEditor {
+		t.Errorf("ForUser() = %+v, want the editor role", orgs)
+	}
+}
+
+// dois owners rebaixando um ao outro ao mesmo tempo não podem deixar a
+// organização sem owner
+func TestOrganizationServiceSetRoleConcurrent(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db}
+	org, owner, other := newOrganization(f)
+	err := service.SetRole(f.ctx, org.ID, other.ID, RoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, user := range []*User{owner, other} {
+		wg.Add(1)
+		go func(i, userID int) {
+			defer wg.Done()
+			errs[i] = service.SetRole(f.ctx, org.ID, userID, RoleEditor)
+		}(i, user.ID)
+	}
+	wg.Wait()
+
+	var lastOwner int
+	for _, err := range errs {
+		if errors.Is(err, ErrLastOwner) {
+			lastOwner++
+		} else if err != nil {
+			t.Fatalf("SetRole() err = %v", err)
+		}
+	}
+	if lastOwner != 1 {
+		t.Errorf("SetRole() errs = %v, want exactly one %v", errs, ErrLastOwner)
+	}
+	if n := f.count("organization_members", "organization_id = $1 AND role = $2", org.ID, RoleOwner); n != 1 {
+		t.Errorf("owners = %d, want 1", n)
+	}
+}
+
+func TestOrganizationServiceRemoveMember(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db}
+	org, owner, viewer := newOrganization(f)
+
+	err := service.RemoveMember(f.ctx, org.ID, owner.ID)
+	if !errors.Is(err, ErrLastOwner) {
+		t.Errorf("RemoveMember() on the last owner err = %v, want %v", err, ErrLastOwner)
+	}
+	err = service.RemoveMember(f.ctx, org.ID, f.user().ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveMember() for a non-member err = %v, want %v", err, ErrNotFound)
+	}
+	err = service.RemoveMember(f.ctx, org.ID, viewer.ID)
+	if err != nil {
+		t.Fatalf("RemoveMember() err = %v", err)
+	}
+	members, err := service.Members(f.ctx, org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].UserID != owner.ID {
+		t.Errorf("Members() = %+v, want only the owner", members)
+	}
+}
+
+func TestOrganizationServiceInvitations(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db, InvitationDuration: time.Hour}
+	org, owner, _ := newOrganization(f)
+	invited := f.userWithEmail("invited@example.com")
+
+	_, err := service.Invite(f.ctx, org.ID, invited.Email, "boss", owner.ID)
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Invite() with an invalid role err = %v, want %v", err, ErrInvalidRole)
+	}
+	first, err := service.Invite(f.ctx, org.ID, "Invited@Example.com", RoleViewer, owner.ID)
+	if err != nil {
+		t.Fatalf("Invite() err = %v", err)
+	}
+	invitation, err := service.Invite(f.ctx, org.ID, invited.Email, RoleEditor, owner.ID)
+	if err != nil {
+		t.Fatalf("second Invite() err = %v", err)
+	}
+	if invitation.ID != first.ID || invitation.Email != "invited@example.com" {
+		t.Errorf("second Invite() = %+v, want the same row %d", invitation, first.ID)
+	}
+	assertNear(t, "ExpiresAt", invitation.ExpiresAt, time.Now().Add(time.Hour))
+	_, err = service.Invitation(f.ctx, first.Token)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("Invitation() with the replaced token err = %v, want %v", err, ErrInvalidInvitation)
+	}
+
+	got, err := service.Invitation(f.ctx, invitation.Token)
+	if err != nil {
+		t.Fatalf("Invitation() err = %v", err)
+	}
+	if got.OrganizationID != org.ID || got.Role != RoleEditor || got.InvitedBy != owner.ID {
+		t.Errorf("Invitation() = %+v", got)
+	}
+
+	_, err = service.AcceptInvitation(f.ctx, invitation.Token, owner)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("AcceptInvitation() by another user err = %v, want %v", err, ErrInvalidInvitation)
+	}
+	accepted, err := service.AcceptInvitation(f.ctx, invitation.Token, invited)
+	if err != nil {
+		t.Fatalf("AcceptInvitation() err = %v", err)
+	}
+	if accepted.ID != org.ID {
+		t.Errorf("AcceptInvitation() = %+v, want organization %d", accepted, org.ID)
+	}
+	orgs, err := service.ForUser(f.ctx, invited.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0].Role != RoleEditor {
+		t.Errorf("ForUser() = %+v, want the editor role", orgs)
+	}
+	_, err = service.AcceptInvitation(f.ctx, invitation.Token, invited)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("second AcceptInvitation() err = %v, want %v", err, ErrInvalidInvitation)
+	}
+}
+
+func TestOrganizationServiceExpiredInvitations(t *testing.T) {
+	f := newFixtures(t)
+	service := OrganizationService{DB: f.db}
+	org, owner, _ := newOrganization(f)
+	expired, err := service.Invite(f.ctx, org.ID, "old@example.com", RoleViewer, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := service.Invite(f.ctx, org.ID, "new@example.com", RoleViewer, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.exec(`UPDATE organization_invitations SET expires_at = $2 WHERE id = $1;`,
+		expired.ID, time.Now().Add(-time.Minute))
+
+	_, err = service.Invitation(f.ctx, expired.Token)
+	if !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("Invitation() expired err = %v, want %v", err, ErrInvalidInvitation)
+	}
+	n, err := service.DeleteExpiredInvitations(f.ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredInvitations() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteExpiredInvitations() = %d, want 1", n)
+	}
+	_, err = service.Invitation(f.ctx, valid.Token)
+	if err != nil {
+		t.Errorf("valid invitation was removed: %v", err)
+	}
+}
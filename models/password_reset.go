@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
@@ -38,16 +39,15 @@ type PasswordResetService struct {
 	Duration time.Duration
 }
 
-func (service *PasswordResetService) Create(email string) (*PasswordReset, error) {
+func (service *PasswordResetService) Create(ctx context.Context, email string) (*PasswordReset, error) {
 	// Verify we have a valid email address for a user
 	email = strings.ToLower(email)
 	var userID int
-	row := service.DB.QueryRow(`
+	row := conn(ctx, service.DB).QueryRowContext(ctx, `
 		SELECT id FROM users WHERE email = $1;`, email)
 	err := row.Scan(&userID)
 	if err != nil {
-		// TODO: Consider returning a specific error when the user does not exist.
-		return nil, fmt.Errorf("create: %w", err)
+		return nil, fmt.Errorf("create: %w", noRows(err, ErrNotFound))
 	}
 
 	// Build the PasswordReset
@@ -70,7 +70,7 @@ func (service *PasswordResetService) Create(email string) (*PasswordReset, error
 		ExpiresAt: time.Now().Add(duration),
 	}
 	// Insert the PasswordReset into the DB
-	row = service.DB.QueryRow(`
+	row = conn(ctx, service.DB).QueryRowContext(ctx, `
 	 INSERT INTO password_resets (user_id, token_hash, expires_at)
 	 VALUES ($1, $2, $3) ON CONFLICT (user_id) DO
 	 UPDATE
@@ -84,34 +84,39 @@ func (service *PasswordResetService) Create(email string) (*PasswordReset, error
 }
 
 // We are going to consume a token and return the user associated with it, or return an error if the token wasn't valid for any reason.
-func (service *PasswordResetService) Consume(token string) (*User, error) {
+func (service *PasswordResetService) Consume(ctx context.Context, token string) (*User, error) {
 	tokenHash := service.hash(token)
 	var user User
 	var pwReset PasswordReset
-	// busca se hé um reset de password definido para esse token
-	row := service.DB.QueryRow(`
-		SELECT password_resets.id,
-			password_resets.expires_at,
-			users.id,
-			users.email,
-			users.password_hash
-		FROM password_resets
-			JOIN users ON users.id = password_resets.user_id
-		WHERE password_resets.token_hash = $1;`, tokenHash)
-	err := row.Scan(
-		&pwReset.ID, &pwReset.ExpiresAt,
-		&user.ID, &user.Email, &user.PasswordHash)
-	if err != nil {
-		return nil, fmt.Errorf("consume: %w", err)
-	}
-	// verifica se já expirou
-	if time.Now().After(pwReset.ExpiresAt) {
-		return nil, fmt.Errorf("token expires: %v", token)
-	}
-	// deleta o reset de password para que não possa ser reutilizado
-	err = service.delete(pwReset.ID)
+	// chamado dentro de InTx, o token só é gasto se o resto da operação
+	// também for confirmado
+	err := InTx(ctx, service.DB, func(ctx context.Context) error {
+		// o DELETE ... RETURNING busca e gasta o token de uma vez: com duas
+		// requisições concorrentes usando o mesmo token só uma recebe a linha
+		row := conn(ctx, service.DB).QueryRowContext(ctx, `
+			DELETE FROM password_resets
+			WHERE token_hash = $1
+			RETURNING id, user_id, expires_at;`, tokenHash)
+		err := row.Scan(&pwReset.ID, &pwReset.UserID, &pwReset.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("consume: %w", noRows(err, ErrExpiredToken))
+		}
+		// verifica se já expirou
+		if time.Now().After(pwReset.ExpiresAt) {
+			return fmt.Errorf("consume: %w", ErrExpiredToken)
+		}
+		row = conn(ctx, service.DB).QueryRowContext(ctx, `
+			SELECT id, email, password_hash
+			FROM users
+			WHERE id = $1;`, pwReset.UserID)
+		err = row.Scan(&user.ID, &user.Email, &user.PasswordHash)
+		if err != nil {
+			return fmt.Errorf("consume: %w", noRows(err, ErrExpiredToken))
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("consume: %w", err)
+		return nil, err
 	}
 	// retorna dados de usuário para que possa ser atualizado com nova senha
 	return &user, nil
@@ -122,13 +127,17 @@ func (service *PasswordResetService) hash(token string) string {
 	return base64.URLEncoding.EncodeToString(tokenHash[:])
 }
 
-// deletar para que não possa ser reutilizado
-func (service *PasswordResetService) delete(id int) error {
-	_, err := service.DB.Exec(`
+// DeleteExpired remove os resets que expiraram sem ser usados
+func (service *PasswordResetService) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := conn(ctx, service.DB).ExecContext(ctx, `
 		DELETE FROM password_resets
-		WHERE id = $1;`, id)
+		WHERE expires_at < $1;`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired password resets: %w", err)
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("delete: %w", err)
+		return 0, fmt.Errorf("delete expired password resets: %w", err)
 	}
-	return nil
+	return n, nil
 }
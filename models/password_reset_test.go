@@ -0,0 +1,123 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetServiceCreate(t *testing.T) {
+	f := newFixtures(t)
+	service := PasswordResetService{DB: f.db, Duration: 2 * time.Hour}
+	user := f.userWithEmail("jon@example.com")
+
+	pwReset, err := service.Create(f.ctx, "JON@example.com")
+	if err != nil {
+		t.Fatalf("Create() err = %v", err)
+	}
+	if pwReset.UserID != user.ID || pwReset.Token == "" {
+		t.Errorf("Create() = %+v, want a token for user %d", pwReset, user.ID)
+	}
+	assertNear(t, "ExpiresAt", pwReset.ExpiresAt, time.Now().Add(2*time.Hour))
+
+	_, err = service.Create(f.ctx, "nobody@example.com")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Create() for an unknown email err = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestPasswordResetServiceConsume(t *testing.T) {
+	f := newFixtures(t)
+	service := PasswordResetService{DB: f.db}
+	user := f.user()
+	pwReset := f.passwordReset(user)
+
+	got, err := service.Consume(f.ctx, pwReset.Token)
+	if err != nil {
+		t.Fatalf("Consume() err = %v", err)
+	}
+	if got.ID != user.ID || got.Email != user.Email {
+		t.Errorf("Consume() = %+v, want %+v", got, user)
+	}
+	// o token só pode ser usado uma vez
+	_, err = service.Consume(f.ctx, pwReset.Token)
+	if !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("second Consume() err = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestPasswordResetServiceConsumeConcurrent(t *testing.T) {
+	f := newFixtures(t)
+	service := PasswordResetService{DB: f.db}
+	pwReset := f.passwordReset(f.user())
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.Consume(f.ctx, pwReset.Token)
+		}(i)
+	}
+	wg.Wait()
+
+	var consumed int
+	for _, err := range errs {
+		if err == nil {
+			consumed++
+		} else if !errors.Is(err, ErrExpiredToken) {
+			t.Fatalf("Consume() err = %v", err)
+		}
+	}
+	if consumed != 1 {
+		t.Errorf("Consume() succeeded %d times, want 1", consumed)
+	}
+}
+
+func TestPasswordResetServiceConsumeInvalid(t *testing.T) {
+	f := newFixtures(t)
+	service := PasswordResetService{DB: f.db}
+	user := f.user()
+
+	t.Run("replaced", func(t *testing.T) {
+		first := f.passwordReset(user)
+		f.passwordReset(user)
+		_, err := service.Consume(f.ctx, first.Token)
+		if err == nil {
+			t.Error("Consume() with a replaced token err = nil")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		pwReset := f.passwordReset(user)
+		f.exec(`UPDATE password_resets SET expires_at = $2 WHERE id = $1;`,
+			pwReset.ID, time.Now().Add(-time.Minute))
+		_, err := service.Consume(f.ctx, pwReset.Token)
+		if err == nil {
+			t.Error("Consume() with an expired token err = nil")
+		}
+	})
+}
+
+func TestPasswordResetServiceDeleteExpired(t *testing.T) {
+	f := newFixtures(t)
+	service := PasswordResetService{DB: f.db}
+	expired := f.passwordReset(f.user())
+	valid := f.passwordReset(f.user())
+	f.exec(`UPDATE password_resets SET expires_at = $2 WHERE id = $1;`,
+		expired.ID, time.Now().Add(-time.Minute))
+
+	n, err := service.DeleteExpired(f.ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpired() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteExpired() = %d, want 1", n)
+	}
+	_, err = service.Consume(f.ctx, valid.Token)
+	if err != nil {
+		t.Errorf("valid reset was removed: %v", err)
+	}
+}
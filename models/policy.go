@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Ações que podem ser feitas sobre um recurso, como uma galeria
+type Action string
+
+const (
+	// ActionView permite ver o recurso
+	ActionView Action = "view"
+	// ActionEdit permite alterar o conteúdo do recurso
+	ActionEdit Action = "edit"
+	// ActionManage permite remover o recurso, transferi-lo ou, no caso de uma
+	// organização, gerenciar seus membros
+	ActionManage Action = "manage"
+)
+
+// Owner identifica o dono de um recurso, que pode ser um usuário ou uma
+// organização. Apenas um dos campos deve ser diferente de zero.
+type Owner struct {
+	UserID         int
+	OrganizationID int
+}
+
+func UserOwner(userID int) Owner {
+	return Owner{UserID: userID}
+}
+
+func OrganizationOwner(orgID int) Owner {
+	return Owner{OrganizationID: orgID}
+}
+
+// Policy concentra as regras de autorização sobre recursos que pertencem a um
+// usuário ou a uma organização. Todas as checagens de acesso a galerias e
+// organizações devem passar por Authorize, assim as regras ficam num só lugar.
+type Policy struct {
+	DB *sql.DB
+}
+
+// Authorize retorna ErrForbidden caso o usuário não possa executar a ação
+// sobre um recurso do dono informado.
+//
+// Recursos de um usuário só podem ser acessados por ele. Em recursos de uma
+// organização, viewers podem ver, editors podem ver e editar e owners podem
+// fazer tudo.
+func (p *Policy) Authorize(ctx context.Context, user *User, action Action, owner Owner) error {
+	if user == nil {
+		return ErrForbidden
+	}
+	switch {
+	case owner.UserID != 0:
+		if owner.UserID == user.ID {
+			return nil
+		}
+		return ErrForbidden
+	case owner.OrganizationID != 0:
+		role, err := p.role(ctx, owner.OrganizationID, user.ID)
+		if err != nil {
+			return fmt.Errorf("authorize: %w", err)
+		}
+		if roleAllows(role, action) {
+			return nil
+		}
+		return ErrForbidden
+	}
+	return ErrForbidden
+}
+
+// role retorna o papel do usuário na organização ou "" caso não seja membro
+func (p *Policy) role(ctx context.Context, orgID, userID int) (string, error) {
+	var role string
+	row := conn(ctx, p.DB).QueryRowContext(ctx, `
+		SELECT role
+		FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2;`, orgID, userID)
+	err := row.Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+func roleAllows(role string, action Action) bool {
+	switch role {
+	case RoleOwner:
+		return true
+	case RoleEditor:
+		return action == ActionView || action == ActionEdit
+	case RoleViewer:
+		return action == ActionView
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyAuthorizeUserOwner(t *testing.T) {
+	f := newFixtures(t)
+	p := Policy{DB: f.db}
+	user := f.user()
+	other := f.user()
+
+	for _, action := range []Action{ActionView, ActionEdit, ActionManage} {
+		err := p.Authorize(f.ctx, user, action, UserOwner(user.ID))
+		if err != nil {
+			t.Errorf("Authorize(%s) on own resource err = %v", action, err)
+		}
+		err = p.Authorize(f.ctx, other, action, UserOwner(user.ID))
+		if !errors.Is(err, ErrForbidden) {
+			t.Errorf("Authorize(%s) on another user's resource err = %v, want %v", action, err, ErrForbidden)
+		}
+	}
+	err := p.Authorize(f.ctx, nil, ActionView, UserOwner(user.ID))
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize() without a user err = %v, want %v", err, ErrForbidden)
+	}
+	err = p.Authorize(f.ctx, user, ActionView, Owner{})
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize() without an owner err = %v, want %v", err, ErrForbidden)
+	}
+}
+
+func TestPolicyAuthorizeOrganizationOwner(t *testing.T) {
+	f := newFixtures(t)
+	p := Policy{DB: f.db}
+	service := OrganizationService{DB: f.db}
+	org, owner, viewer := newOrganization(f)
+	editor := f.user()
+	err := service.addMember(f.ctx, org.ID, editor.ID, RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsider := f.user()
+
+	tests := []struct {
+		name  string
+		user  *User
+		allow map[Action]bool
+	}{
+		{"owner", owner, map[Action]bool{ActionView: true, ActionEdit: true, ActionManage: true}},
+		{"editor", editor, map[Action]bool{ActionView: true, ActionEdit: true}},
+		{"viewer", viewer, map[Action]bool{ActionView: true}},
+		{"outsider", outsider, map[Action]bool{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, action := range []Action{ActionView, ActionEdit, ActionManage} {
+				err := p.Authorize(f.ctx, tc.user, action, OrganizationOwner(org.ID))
+				if tc.allow[action] && err != nil {
+					t.Errorf("Authorize(%s) err = %v, want nil", action, err)
+				}
+				if !tc.allow[action] && !errors.Is(err, ErrForbidden) {
+					t.Errorf("Authorize(%s) err = %v, want %v", action, err, ErrForbidden)
+				}
+			}
+		})
+	}
+}
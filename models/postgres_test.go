@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationStatus(t *testing.T) {
+	db := testDB(t)
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	status, err := CheckMigrations(context.Background(), db, testMigrations(db), ".")
+	if err != nil {
+		t.Fatalf("CheckMigrations() after migrating err = %v", err)
+	}
+	if status.Current == 0 || status.Current != status.Expected || len(status.Pending) != 0 {
+		t.Errorf("status = %+v, want the database up to date", status)
+	}
+
+	err = MigrateDownFS(db, testMigrations(db), ".")
+	if err != nil {
+		t.Fatalf("MigrateDownFS() err = %v", err)
+	}
+	down, err := GetMigrationStatusFS(context.Background(), db, testMigrations(db), ".")
+	if err != nil {
+		t.Fatalf("GetMigrationStatusFS() err = %v", err)
+	}
+	if down.Current >= status.Expected || len(down.Pending) != 1 {
+		t.Errorf("status after MigrateDownFS() = %+v, want one pending migration", down)
+	}
+	_, err = CheckMigrations(context.Background(), db, testMigrations(db), ".")
+	if !errors.Is(err, ErrPendingMigrations) {
+		t.Errorf("CheckMigrations() err = %v, want %v", err, ErrPendingMigrations)
+	}
+
+	err = MigrateFS(db, testMigrations(db), ".")
+	if err != nil {
+		t.Fatalf("MigrateFS() err = %v", err)
+	}
+	_, err = CheckMigrations(context.Background(), db, testMigrations(db), ".")
+	if err != nil {
+		t.Errorf("CheckMigrations() after migrating up again err = %v", err)
+	}
+}
+
+func TestMigrationStatusEmptyDatabase(t *testing.T) {
+	db := emptyTestDB(t)
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	status, err := GetMigrationStatusFS(context.Background(), db, testMigrations(db), ".")
+	if err != nil {
+		t.Fatalf("GetMigrationStatusFS() err = %v", err)
+	}
+	if status.Current != 0 || status.Expected == 0 || len(status.Pending) == 0 {
+		t.Errorf("status = %+v, want every migration pending", status)
+	}
+	// verificar o status não pode escrever no banco
+	exists, err := DialectOf(db).TableExists(context.Background(), db, gooseVersionTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Errorf("GetMigrationStatusFS() created the %s table", gooseVersionTable)
+	}
+}
+
+func TestPostgresConfigString(t *testing.T) {
+	cfg := DefaultPostgresConfig()
+	cfg.SSLMode = "verify-full"
+	cfg.SSLRootCert = "/etc/ssl/root.crt"
+	want := "host=localhost port=5432 user=lenslocked password=lenslocked dbname=lenslocked sslmode=verify-full sslrootcert=/etc/ssl/root.crt"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	cfg.URL = "postgres://primary/lenslocked"
+	cfg.ReplicaURL = "postgres://replica/lenslocked"
+	if got := cfg.String(); got != cfg.URL {
+		t.Errorf("String() = %q, want the URL %q", got, cfg.URL)
+	}
+	replica := cfg.ReplicaConfig()
+	if replica.String() != cfg.ReplicaURL || replica.ReplicaURL != "" {
+		t.Errorf("ReplicaConfig() = %+v, want the replica URL", replica)
+	}
+	if replica.MaxOpenConns != cfg.MaxOpenConns {
+		t.Errorf("ReplicaConfig().MaxOpenConns = %d, want %d", replica.MaxOpenConns, cfg.MaxOpenConns)
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	dir := t.TempDir()
+	sqliteDir := filepath.Join(dir, "sqlite")
+	err := os.Mkdir(sqliteDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{dir, sqliteDir} {
+		err = os.WriteFile(filepath.Join(d, "00001_users.sql"), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = CreateMigration(dir, "add_photos")
+	if err != nil {
+		t.Fatalf("CreateMigration() err = %v", err)
+	}
+	for _, d := range []string{dir, sqliteDir} {
+		_, err = os.Stat(filepath.Join(d, "00002_add_photos.sql"))
+		if err != nil {
+			t.Errorf("CreateMigration() didn't create the migration in %s: %v", d, err)
+		}
+	}
+
+	// um diretório atrasado não pode receber uma versão diferente
+	err = os.Remove(filepath.Join(sqliteDir, "00002_add_photos.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CreateMigration(dir, "add_galleries")
+	if err == nil {
+		t.Errorf("CreateMigration() with directories out of sync err = nil, want an error")
+	}
+	_, err = os.Stat(filepath.Join(dir, "00003_add_galleries.sql"))
+	if !os.IsNotExist(err) {
+		t.Errorf("CreateMigration() with directories out of sync created a migration")
+	}
+}
+
+func TestDialectOf(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "dialect.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := DialectOf(db).Name(); got != DriverSQLite {
+		t.Errorf("DialectOf(OpenSQLite()) = %s, want %s", got, DriverSQLite)
+	}
+	// conexões abertas fora do pacote são tratadas como Postgres
+	other, err := sql.Open("pgx", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if got := DialectOf(other).Name(); got != DriverPostgres {
+		t.Errorf("DialectOf(sql.Open()) = %s, want %s", got, DriverPostgres)
+	}
+}
+
+func TestCheckMigrationsCanceled(t *testing.T) {
+	db := testDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// o /readyz depende do ctx para não ficar preso num lock do banco
+	_, err := CheckMigrations(ctx, db, testMigrations(db), ".")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CheckMigrations() with a canceled ctx err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	db := testDB(t)
+	err := DialectOf(db).CheckWritable(context.Background(), db)
+	if err != nil {
+		t.Errorf("CheckWritable() err = %v, want nil", err)
+	}
+}
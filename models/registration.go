@@ -0,0 +1,19 @@
+package models
+
+import "fmt"
+
+// Modos de cadastro suportados. No modo InviteOnly apenas quem recebeu um
+// convite consegue criar uma conta e no modo Closed ninguém consegue
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite-only"
+	RegistrationClosed     = "closed"
+)
+
+func ValidRegistrationMode(mode string) error {
+	switch mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed:
+		return nil
+	}
+	return fmt.Errorf("invalid registration mode %q", mode)
+}
@@ -1,10 +1,12 @@
 package models
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/vitoraalmeida/lenslocked/rand"
 )
@@ -30,7 +32,7 @@ type SessionService struct {
 	BytesPerToken int
 }
 
-func (ss *SessionService) Create(userID int) (*Session, error) {
+func (ss *SessionService) Create(ctx context.Context, userID int) (*Session, error) {
 	bytesPerToken := ss.BytesPerToken
 	if bytesPerToken < MinBytesPerToken {
 		bytesPerToken = MinBytesPerToken
@@ -48,13 +50,13 @@ func (ss *SessionService) Create(userID int) (*Session, error) {
 	/*
 		// tenta primeiro atualizar uma sessão existente com um novo token,
 		// se não existir uma sessão, cria uma nova
-		row := ss.DB.QueryRow(
+		row := conn(ctx, ss.DB).QueryRowContext(ctx,
 			`UPDATE sessions SET token_hash = $2 WHERE user_id = $1 RETURNING id;`,
 			session.UserID, session.TokenHash)
 		err = row.Scan(&session.ID)
 		// quando não há nenhuma linha retornada, o pacote sql do go gera o erro ErrNoRows
 		if err == sql.ErrNoRows {
-			row = ss.DB.QueryRow(
+			row = conn(ctx, ss.DB).QueryRowContext(ctx,
 				`INSERT INTO sessions (user_id, token_hash) VALUES ($1, $2) RETURNING id;`,
 				session.UserID, session.TokenHash)
 			err = row.Scan(&session.ID)
@@ -62,12 +64,12 @@ func (ss *SessionService) Create(userID int) (*Session, error) {
 	*/
 
 	/* para o postgres podemos fazer uma query só para o mesmo resultado*/
-	row := ss.DB.QueryRow(`
-		INSERT INTO sessions (user_id, token_hash)
-		VALUES ($1, $2) ON CONFLICT (user_id) DO
+	row := conn(ctx, ss.DB).QueryRowContext(ctx, `
+		INSERT INTO sessions (user_id, token_hash, created_at)
+		VALUES ($1, $2, $3) ON CONFLICT (user_id) DO
 		UPDATE
-		SET token_hash = $2
-		RETURNING id;`, session.UserID, session.TokenHash)
+		SET token_hash = $2, created_at = $3
+		RETURNING id;`, session.UserID, session.TokenHash, time.Now())
 	err = row.Scan(&session.ID)
 
 	// checa por outros erros
@@ -78,30 +80,31 @@ func (ss *SessionService) Create(userID int) (*Session, error) {
 	return &session, nil
 }
 
-func (ss *SessionService) User(token string) (*User, error) {
+func (ss *SessionService) User(ctx context.Context, token string) (*User, error) {
 	tokenHash := ss.hash(token)
-	row := ss.DB.QueryRow(`
+	row := conn(ctx, ss.DB).QueryRowContext(ctx, `
 	SELECT
 		users.id,
 		users.email,
-		users.password_hash
+		users.password_hash,
+		users.is_admin
 	FROM
 		sessions
 		JOIN users ON users.id = sessions.user_id
 	WHERE
 		sessions.token_hash = $1;`, tokenHash)
 	var user User
-	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash)
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.IsAdmin)
 	if err != nil {
-		return nil, fmt.Errorf("user: %w", err)
+		return nil, fmt.Errorf("user: %w", noRows(err, ErrNotFound))
 	}
 
 	return &user, nil
 }
 
-func (ss *SessionService) Delete(token string) error {
+func (ss *SessionService) Delete(ctx context.Context, token string) error {
 	tokenHash := ss.hash(token)
-	_, err := ss.DB.Exec(`
+	_, err := conn(ctx, ss.DB).ExecContext(ctx, `
 		DELETE FROM sessions
 		WHERE token_hash = $1;`, tokenHash)
 	if err != nil {
@@ -110,6 +113,51 @@ func (ss *SessionService) Delete(token string) error {
 	return nil
 }
 
+// DeleteAll encerra as sessões de todos os usuários e retorna quantas foram
+// removidas
+func (ss *SessionService) DeleteAll(ctx context.Context) (int64, error) {
+	res, err := conn(ctx, ss.DB).ExecContext(ctx, `DELETE FROM sessions;`)
+	if err != nil {
+		return 0, fmt.Errorf("delete all sessions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete all sessions: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteForUser encerra as sessões de um usuário
+func (ss *SessionService) DeleteForUser(ctx context.Context, userID int) (int64, error) {
+	res, err := conn(ctx, ss.DB).ExecContext(ctx, `
+		DELETE FROM sessions
+		WHERE user_id = $1;`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("delete user sessions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete user sessions: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteOlderThan remove as sessões criadas há mais de maxAge, obrigando
+// esses usuários a fazer sign in novamente
+func (ss *SessionService) DeleteOlderThan(ctx context.Context, maxAge time.Duration) (int64, error) {
+	res, err := conn(ctx, ss.DB).ExecContext(ctx, `
+		DELETE FROM sessions
+		WHERE created_at < $1;`, time.Now().Add(-maxAge))
+	if err != nil {
+		return 0, fmt.Errorf("delete old sessions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete old sessions: %w", err)
+	}
+	return n, nil
+}
+
 func (ss *SessionService) hash(token string) string {
 	// não utiliza bcrypt pois ele adiciona um salt em cada geração de hash,
 	// de forma que seria necessário adicionar uma lógica para definir qual
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionServiceCreateAndUser(t *testing.T) {
+	f := newFixtures(t)
+	ss := SessionService{DB: f.db}
+	user := f.user()
+
+	session, err := ss.Create(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Create() err = %v", err)
+	}
+	if len(session.Token) == 0 || session.TokenHash == session.Token {
+		t.Errorf("Create() = %+v, want a token and its hash", session)
+	}
+	got, err := ss.User(f.ctx, session.Token)
+	if err != nil {
+		t.Fatalf("User() err = %v", err)
+	}
+	if got.ID != user.ID || got.Email != user.Email {
+		t.Errorf("User() = %+v, want %+v", got, user)
+	}
+
+	// cada usuário tem uma sessão, então a anterior deixa de valer
+	second, err := ss.Create(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("second Create() err = %v", err)
+	}
+	if second.ID != session.ID {
+		t.Errorf("second Create() ID = %d, want the same row %d", second.ID, session.ID)
+	}
+	_, err = ss.User(f.ctx, session.Token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("User() with the old token err = %v, want %v", err, ErrNotFound)
+	}
+	_, err = ss.User(f.ctx, second.Token)
+	if err != nil {
+		t.Errorf("User() with the new token err = %v", err)
+	}
+}
+
+func TestSessionServiceDelete(t *testing.T) {
+	f := newFixtures(t)
+	ss := SessionService{DB: f.db}
+	session := f.session(f.user())
+
+	err := ss.Delete(f.ctx, session.Token)
+	if err != nil {
+		t.Fatalf("Delete() err = %v", err)
+	}
+	_, err = ss.User(f.ctx, session.Token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("User() after Delete() err = %v, want %v", err, ErrNotFound)
+	}
+	// remover um token que não existe não é um erro
+	err = ss.Delete(f.ctx, session.Token)
+	if err != nil {
+		t.Errorf("Delete() twice err = %v", err)
+	}
+}
+
+func TestSessionServiceDeleteAllAndForUser(t *testing.T) {
+	f := newFixtures(t)
+	ss := SessionService{DB: f.db}
+	first := f.user()
+	f.session(first)
+	f.session(f.user())
+	f.session(f.user())
+
+	n, err := ss.DeleteForUser(f.ctx, first.ID)
+	if err != nil {
+		t.Fatalf("DeleteForUser() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteForUser() = %d, want 1", n)
+	}
+	n, err = ss.DeleteAll(f.ctx)
+	if err != nil {
+		t.Fatalf("DeleteAll() err = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteAll() = %d, want 2", n)
+	}
+}
+
+func TestSessionServiceDeleteOlderThan(t *testing.T) {
+	f := newFixtures(t)
+	ss := SessionService{DB: f.db}
+	old := f.session(f.user())
+	recent := f.session(f.user())
+	f.exec(`UPDATE sessions SET created_at = $2 WHERE id = $1;`, old.ID, time.Now().Add(-48*time.Hour))
+
+	n, err := ss.DeleteOlderThan(f.ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("DeleteOlderThan() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteOlderThan() = %d, want 1", n)
+	}
+	_, err = ss.User(f.ctx, recent.Token)
+	if err != nil {
+		t.Errorf("recent session was removed: %v", err)
+	}
+}
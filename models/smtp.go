@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-mail/mail"
+)
+
+const (
+	// DefaultSMTPPoolSize is the default number of idle SMTP connections kept
+	// open between sends.
+	DefaultSMTPPoolSize = 2
+	// DefaultSMTPIdleTimeout is the default time an idle SMTP connection is
+	// kept open. Most servers drop idle clients after a minute or so.
+	DefaultSMTPIdleTimeout = 30 * time.Second
+)
+
+// smtpPool mantém conexões SMTP abertas entre os envios, evitando refazer o
+// handshake (e o TLS) a cada email como acontece com DialAndSend.
+type smtpPool struct {
+	dialer      *mail.Dialer
+	conns       chan *smtpConn
+	idleTimeout time.Duration
+}
+
+type smtpConn struct {
+	mail.SendCloser
+	lastUsed time.Time
+}
+
+func newSMTPPool(dialer *mail.Dialer, size int, idleTimeout time.Duration) *smtpPool {
+	if size <= 0 {
+		size = DefaultSMTPPoolSize
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultSMTPIdleTimeout
+	}
+	return &smtpPool{
+		dialer:      dialer,
+		conns:       make(chan *smtpConn, size),
+		idleTimeout: idleTimeout,
+	}
+}
+
+func (p *smtpPool) Send(msg *mail.Message) error {
+	conn, reused, err := p.get()
+	if err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	sender := &dataSender{Sender: conn}
+	err = mail.Send(sender, msg)
+	if err != nil && reused && !sender.data {
+		// o servidor pode ter encerrado a conexão enquanto ela estava parada,
+		// então tentamos mais uma vez com uma conexão nova. Depois do DATA
+		// aceito não: o servidor pode ter recebido a mensagem e o destinatário
+		// a receberia duas vezes
+		conn.Close()
+		conn, err = p.dial()
+		if err != nil {
+			return fmt.Errorf("smtp send: %w", err)
+		}
+		err = mail.Send(conn, msg)
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	p.put(conn)
+	return nil
+}
+
+// dataSender registra se o servidor aceitou o DATA. O conteúdo da mensagem
+// só é escrito depois disso, então basta observar o WriteTo
+type dataSender struct {
+	mail.Sender
+	data bool
+}
+
+func (s *dataSender) Send(from string, to []string, msg io.WriterTo) error {
+	return s.Sender.Send(from, to, writerToFunc(func(w io.Writer) (int64, error) {
+		s.data = true
+		return msg.WriteTo(w)
+	}))
+}
+
+type writerToFunc func(w io.Writer) (int64, error)
+
+func (f writerToFunc) WriteTo(w io.Writer) (int64, error) {
+	return f(w)
+}
+
+// Close encerra todas as conexões paradas no pool
+func (p *smtpPool) Close() error {
+	for {
+		select {
+		case conn := <-p.conns:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *smtpPool) get() (*smtpConn, bool, error) {
+	for {
+		select {
+		case conn := <-p.conns:
+			if time.Since(conn.lastUsed) > p.idleTimeout {
+				conn.Close()
+				continue
+			}
+			return conn, true, nil
+		default:
+			conn, err := p.dial()
+			return conn, false, err
+		}
+	}
+}
+
+func (p *smtpPool) put(conn *smtpConn) {
+	conn.lastUsed = time.Now()
+	select {
+	case p.conns <- conn:
+	default:
+		// o pool já está cheio
+		conn.Close()
+	}
+}
+
+func (p *smtpPool) dial() (*smtpConn, error) {
+	sc, err := p.dialer.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return &smtpConn{SendCloser: sc}, nil
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// OpenSQLite abre o banco SQLite do arquivo path, criando-o se não existir.
+// Serve para instalações pequenas, em um único processo, que não querem manter
+// um servidor Postgres.
+func OpenSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, errors.New("open sqlite: missing database path")
+	}
+	// foreign_keys liga o ON DELETE CASCADE, desligado por padrão no SQLite.
+	// _txlock=immediate faz as transações pegarem o lock de escrita logo no
+	// início, o que evita erros de banco ocupado quando duas delas tentam
+	// escrever ao mesmo tempo
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)" +
+		"&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+	db, err := openDB(sqliteRebindDriver{}, dsn, SQLite, semconv.DBSystemSqlite)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	return db, nil
+}
+
+// SQLite is the Dialect of the databases opened by OpenSQLite.
+var SQLite Dialect = &sqliteDialect{}
+
+type sqliteDialect struct {
+	// um canal com buffer de 1 por chave faz o papel dos advisory locks
+	locks sync.Map
+}
+
+func (*sqliteDialect) Name() string {
+	return DriverSQLite
+}
+
+func (*sqliteDialect) IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// Os locks do SQLite só valem dentro do processo. Não há advisory locks no
+// banco, e com SQLite a aplicação roda numa única instância.
+func (d *sqliteDialect) Lock(ctx context.Context, db *sql.DB, key int64) (func(), error) {
+	lock := d.lock(key)
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (*sqliteDialect) TableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1
+		);`, table).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("table exists: %w", err)
+	}
+	return exists, nil
+}
+
+func (*sqliteDialect) CheckWritable(ctx context.Context, db *sql.DB) error {
+	// o BEGIN sozinho funciona mesmo num arquivo somente leitura. Reescrever
+	// o user_version com o mesmo valor é uma escrita de verdade, desfeita no
+	// rollback
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("check writable: %w", err)
+	}
+	defer tx.Rollback()
+	var version int
+	err = tx.QueryRowContext(ctx, `PRAGMA user_version;`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("check writable: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d;`, version))
+	if err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_READONLY {
+			return fmt.Errorf("check writable: %w: %v", ErrReadOnly, err)
+		}
+		return fmt.Errorf("check writable: %w", err)
+	}
+	return nil
+}
+
+func (d *sqliteDialect) TryLock(ctx context.Context, db *sql.DB, key int64) (func(), bool, error) {
+	lock := d.lock(key)
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+func (d *sqliteDialect) lock(key int64) chan struct{} {
+	lock, _ := d.locks.LoadOrStore(key, make(chan struct{}, 1))
+	return lock.(chan struct{})
+}
+
+// forUpdate casa o FOR UPDATE [SKIP LOCKED] do Postgres. No SQLite as escritas
+// já são serializadas pelo lock do banco, então a cláusula é só removida
+var forUpdate = regexp.MustCompile(`\s+FOR\s+UPDATE(\s+SKIP\s+LOCKED)?`)
+
+// sqliteRebind adapta uma query escrita para o Postgres. Os placeholders $1,
+// ON CONFLICT e RETURNING são entendidos pelo SQLite como estão.
+func sqliteRebind(query string) string {
+	if !strings.Contains(query, "FOR UPDATE") {
+		return query
+	}
+	return forUpdate.ReplaceAllString(query, "")
+}
+
+var sqliteDriver = &sqlite.Driver{}
+
+// sqliteConnector abre as conexões do driver do SQLite embrulhadas em um
+// sqliteConn
+type sqliteConnector struct {
+	dsn string
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sqliteDriver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	inner, ok := conn.(sqliteDriverConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("open sqlite: unexpected connection type %T", conn)
+	}
+	return &sqliteConn{inner}, nil
+}
+
+func (c sqliteConnector) Driver() driver.Driver {
+	return sqliteRebindDriver{}
+}
+
+// sqliteRebindDriver é o driver dos sqliteConn, que o otelsql embrulha
+type sqliteRebindDriver struct{}
+
+func (sqliteRebindDriver) Open(dsn string) (driver.Conn, error) {
+	return sqliteConnector{dsn: dsn}.Connect(context.Background())
+}
+
+func (sqliteRebindDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	return sqliteConnector{dsn: dsn}, nil
+}
+
+// sqliteDriverConn são as interfaces implementadas pela conexão do driver
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+// sqliteConn traduz as queries com sqliteRebind e grava as datas em UTC. O
+// SQLite guarda datas como texto e as compara como texto, então datas com
+// fusos diferentes não poderiam ser comparadas em queries como
+// expires_at < $1.
+type sqliteConn struct {
+	sqliteDriverConn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.sqliteDriverConn.Prepare(sqliteRebind(query))
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.sqliteDriverConn.PrepareContext(ctx, sqliteRebind(query))
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sqliteDriverConn.ExecContext(ctx, sqliteRebind(query), args)
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.sqliteDriverConn.QueryContext(ctx, sqliteRebind(query), args)
+}
+
+// CheckNamedValue implements driver.NamedValueChecker
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := v.(time.Time); ok {
+		v = t.UTC()
+	}
+	nv.Value = v
+	return nil
+}
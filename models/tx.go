@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// dbtx são os métodos comuns a *sql.DB e *sql.Tx usados pelos serviços
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// txValue guarda junto da transação o banco em que ela foi aberta, assim um
+// serviço com outro *sql.DB, como uma réplica, não a usa por engano
+type txValue struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// InTx executa fn dentro de uma transação. Os serviços chamados com o ctx
+// recebido por fn, e com o mesmo db, participam dela: tudo é confirmado se fn
+// retornar nil e desfeito caso contrário. Quando ctx já está dentro de uma
+// transação de db, fn apenas participa dela.
+//
+// As consultas desviadas para uma réplica de leitura ficam fora da transação.
+func InTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if txFrom(ctx, db) != nil {
+		return fn(ctx)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	err = fn(context.WithValue(ctx, txKey{}, txValue{db: db, tx: tx}))
+	if err != nil {
+		rbErr := tx.Rollback()
+		if rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("rollback: %w", rbErr))
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// conn retorna a transação de ctx, quando houver uma aberta em db, ou o
+// próprio db. Todas as queries dos serviços passam por aqui.
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if tx := txFrom(ctx, db); tx != nil {
+		return tx
+	}
+	return db
+}
+
+func txFrom(ctx context.Context, db *sql.DB) *sql.Tx {
+	v, ok := ctx.Value(txKey{}).(txValue)
+	if !ok || v.db != db {
+		return nil
+	}
+	return v.tx
+}
+
+// Transactor expõe InTx para quem depende apenas de interfaces, como os
+// controllers, que não recebem o *sql.DB.
+type Transactor struct {
+	DB *sql.DB
+}
+
+func (t *Transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return InTx(ctx, t.DB, fn)
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInTx(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+
+	errFail := errors.New("fail")
+	err := InTx(f.ctx, f.db, func(ctx context.Context) error {
+		_, err := us.Create(ctx, "rollback@example.com", testPassword)
+		if err != nil {
+			return err
+		}
+		// participa da transação externa em vez de abrir outra
+		return InTx(ctx, f.db, func(ctx context.Context) error {
+			_, err := us.Create(ctx, "nested@example.com", testPassword)
+			if err != nil {
+				return err
+			}
+			return errFail
+		})
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("InTx() err = %v, want %v", err, errFail)
+	}
+	if n := f.count("users", "TRUE"); n != 0 {
+		t.Errorf("%d users after rollback, want 0", n)
+	}
+
+	var user *User
+	err = InTx(f.ctx, f.db, func(ctx context.Context) error {
+		var err error
+		user, err = us.Create(ctx, "commit@example.com", testPassword)
+		if err != nil {
+			return err
+		}
+		_, err = us.ScheduleDeletion(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InTx() err = %v", err)
+	}
+	got, err := us.ByID(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ByID() after commit err = %v", err)
+	}
+	if got.DeletionScheduledAt.IsZero() {
+		t.Error("deletion was not scheduled")
+	}
+}
+
+func TestPasswordResetConsumeInTx(t *testing.T) {
+	f := newFixtures(t)
+	prs := PasswordResetService{DB: f.db}
+	pwReset := f.passwordReset(f.user())
+
+	// uma falha depois do Consume devolve o token
+	errFail := errors.New("fail")
+	err := InTx(f.ctx, f.db, func(ctx context.Context) error {
+		_, err := prs.Consume(ctx, pwReset.Token)
+		if err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("InTx() err = %v, want %v", err, errFail)
+	}
+	_, err = prs.Consume(f.ctx, pwReset.Token)
+	if err != nil {
+		t.Errorf("Consume() after rollback err = %v", err)
+	}
+}
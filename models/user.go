@@ -1,80 +1,101 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
+	"github.com/vitoraalmeida/lenslocked/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// DefaultDeletionGracePeriod is the default time between a user asking for
+	// their account to be deleted and the data actually being removed.
+	DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+)
+
 var (
 	// A common pattern is to add the package as a prefix to the error for
 	// context.
-	ErrEmailTaken = errors.New("models: email address is already in use")
+	ErrEmailTaken = newError(ErrConflict, "models: email address is already in use")
+	ErrNotAdmin   = newError(ErrForbidden, "models: user is not an admin")
 )
 
 type User struct {
 	ID           int
 	Email        string
 	PasswordHash string
+	// IsAdmin indica se o usuário tem acesso às páginas administrativas,
+	// como a de personificação de usuários
+	IsAdmin bool
+	// DeletionScheduledAt é a data a partir da qual a conta será removida.
+	// Zero quando nenhuma remoção foi pedida
+	DeletionScheduledAt time.Time
 }
 
 type UserService struct {
 	DB *sql.DB
+	// Replica é uma réplica de leitura opcional, usada só por List
+	Replica *sql.DB
+	// DeletionGracePeriod is the amount of time a user has to change their mind
+	// after asking for their account to be deleted. Defaults to
+	// DefaultDeletionGracePeriod
+	DeletionGracePeriod time.Duration
 }
 
-func (us *UserService) Create(email, password string) (*User, error) {
+func (us *UserService) Create(ctx context.Context, email, password string) (*User, error) {
 	email = strings.ToLower(email)
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordHash, err := hashPassword(ctx, password)
 	if err != nil {
 		return nil, fmt.Errorf("create user: %w", err)
 	}
-	passwordHash := string(hashedBytes)
 
 	user := User{
 		Email:        email,
 		PasswordHash: passwordHash,
 	}
-	row := us.DB.QueryRow(`
+	row := conn(ctx, us.DB).QueryRowContext(ctx, `
 		INSERT INTO users (email, password_hash)
 		VALUES ($1, $2) RETURNING id`, email, passwordHash)
 	err = row.Scan(&user.ID)
 	if err != nil {
-		// See if we can use this error as a PgError
-		var pgError *pgconn.PgError
-		// errors.As verifica se na árvore de erros que temos existe algum que
-		// seja o que passamos. Se sim, ele preenche a instância do erro com o
-		// erro concreto.
-		if errors.As(err, &pgError) {
-			// This is a PgError, so see if it matches a unique violation.
-			if pgError.Code == pgerrcode.UniqueViolation {
-				// If this is true, it has to be an email violation since this is the
-				// only way to trigger this type of violation with our SQL.
-				return nil, ErrEmailTaken
-			}
+		if DialectOf(us.DB).IsUniqueViolation(err) {
+			// If this is true, it has to be an email violation since this is the
+			// only way to trigger this type of violation with our SQL.
+			return nil, ErrEmailTaken
 		}
 		return nil, fmt.Errorf("create user: %w", err)
 	}
 	return &user, nil
 }
 
-func (us *UserService) Authenticate(email, password string) (*User, error) {
+func (us *UserService) Authenticate(ctx context.Context, email, password string) (*User, error) {
 	email = strings.ToLower(email)
 	user := User{
 		Email: email,
 	}
 
-	row := us.DB.QueryRow(`SELECT id, password_hash FROM users WHERE email=$1`, email)
-	err := row.Scan(&user.ID, &user.PasswordHash)
+	var deletionScheduledAt sql.NullTime
+	row := conn(ctx, us.DB).QueryRowContext(ctx, `
+		SELECT id, password_hash, is_admin, deletion_scheduled_at
+		FROM users WHERE email=$1`, email)
+	err := row.Scan(&user.ID, &user.PasswordHash, &user.IsAdmin, &deletionScheduledAt)
 	if err != nil {
-		return nil, fmt.Errorf("authenticate: %w", err)
+		// email desconhecido e senha errada têm o mesmo erro, para não revelar
+		// quais emails estão cadastrados
+		return nil, fmt.Errorf("authenticate: %w", noRows(err, ErrInvalidCredentials))
 	}
+	user.DeletionScheduledAt = deletionScheduledAt.Time
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	err = comparePassword(ctx, user.PasswordHash, password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return nil, fmt.Errorf("authenticate: %w", ErrInvalidCredentials)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("authenticate: %w", err)
 	}
@@ -82,13 +103,12 @@ func (us *UserService) Authenticate(email, password string) (*User, error) {
 	return &user, nil
 }
 
-func (us *UserService) UpdatePassword(userID int, password string) error {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (us *UserService) UpdatePassword(ctx context.Context, userID int, password string) error {
+	passwordHash, err := hashPassword(ctx, password)
 	if err != nil {
 		return fmt.Errorf("update password: %w", err)
 	}
-	passwordHash := string(hashedBytes)
-	_, err = us.DB.Exec(`
+	_, err = conn(ctx, us.DB).ExecContext(ctx, `
 	  UPDATE users
 		SET password_hash = $2
 		WHERE id = $1;`, userID, passwordHash)
@@ -97,3 +117,223 @@ func (us *UserService) UpdatePassword(userID int, password string) error {
 	}
 	return nil
 }
+
+func (us *UserService) ByID(ctx context.Context, id int) (*User, error) {
+	user := User{
+		ID: id,
+	}
+	var deletionScheduledAt sql.NullTime
+	row := conn(ctx, us.DB).QueryRowContext(ctx, `
+		SELECT email, password_hash, is_admin, deletion_scheduled_at
+		FROM users
+		WHERE id = $1;`, id)
+	err := row.Scan(&user.Email, &user.PasswordHash, &user.IsAdmin, &deletionScheduledAt)
+	if err != nil {
+		return nil, fmt.Errorf("by id: %w", noRows(err, ErrNotFound))
+	}
+	user.DeletionScheduledAt = deletionScheduledAt.Time
+	return &user, nil
+}
+
+func (us *UserService) ByEmail(ctx context.Context, email string) (*User, error) {
+	user := User{
+		Email: strings.ToLower(email),
+	}
+	var deletionScheduledAt sql.NullTime
+	row := conn(ctx, us.DB).QueryRowContext(ctx, `
+		SELECT id, password_hash, is_admin, deletion_scheduled_at
+		FROM users
+		WHERE email = $1;`, user.Email)
+	err := row.Scan(&user.ID, &user.PasswordHash, &user.IsAdmin, &deletionScheduledAt)
+	if err != nil {
+		return nil, fmt.Errorf("by email: %w", noRows(err, ErrNotFound))
+	}
+	user.DeletionScheduledAt = deletionScheduledAt.Time
+	return &user, nil
+}
+
+// SetAdmin concede ou remove o acesso às páginas administrativas
+func (us *UserService) SetAdmin(ctx context.Context, userID int, isAdmin bool) error {
+	_, err := conn(ctx, us.DB).ExecContext(ctx, `
+		UPDATE users
+		SET is_admin = $2
+		WHERE id = $1;`, userID, isAdmin)
+	if err != nil {
+		return fmt.Errorf("set admin: %w", err)
+	}
+	return nil
+}
+
+// List retorna todos os usuários ordenados pelo id. Usado nas páginas
+// administrativas.
+func (us *UserService) List(ctx context.Context) ([]User, error) {
+	rows, err := conn(ctx, reader(us.DB, us.Replica)).QueryContext(ctx, `
+		SELECT id, email, is_admin
+		FROM users
+		ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Email, &user.IsAdmin)
+		if err != nil {
+			return nil, fmt.Errorf("list users: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return users, nil
+}
+
+// ScheduleDeletion marca a conta para ser removida após o período de carência e
+// encerra a sessão do usuário. Retorna a data em que a remoção acontecerá.
+func (us *UserService) ScheduleDeletion(ctx context.Context, userID int) (time.Time, error) {
+	gracePeriod := us.DeletionGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultDeletionGracePeriod
+	}
+	deleteAt := time.Now().Add(gracePeriod)
+	err := InTx(ctx, us.DB, func(ctx context.Context) error {
+		// recusa já no pedido o que Delete recusaria no fim da carência
+		orgs := OrganizationService{DB: us.DB}
+		_, err := orgs.ownedAlone(ctx, userID)
+		if err != nil {
+			return err
+		}
+		_, err = conn(ctx, us.DB).ExecContext(ctx, `
+			UPDATE users
+			SET deletion_scheduled_at = $2
+			WHERE id = $1;`, userID, deleteAt)
+		if err != nil {
+			return err
+		}
+		_, err = conn(ctx, us.DB).ExecContext(ctx, `
+			DELETE FROM sessions
+			WHERE user_id = $1;`, userID)
+		return err
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("schedule deletion: %w", err)
+	}
+	return deleteAt, nil
+}
+
+func (us *UserService) CancelDeletion(ctx context.Context, userID int) error {
+	_, err := conn(ctx, us.DB).ExecContext(ctx, `
+		UPDATE users
+		SET deletion_scheduled_at = NULL
+		WHERE id = $1;`, userID)
+	if err != nil {
+		return fmt.Errorf("cancel deletion: %w", err)
+	}
+	return nil
+}
+
+// Delete remove definitivamente o usuário. Sessões, resets de senha e afins são
+// removidos pelo ON DELETE CASCADE. Os eventos de auditoria e os emails na
+// fila de envio não têm chave para o usuário, mas guardam o email dele, então
+// são apagados aqui, assim como as organizações em que ele era o único membro.
+// Retorna ErrLastOwner se ele for o único owner de uma organização com outros
+// membros.
+func (us *UserService) Delete(ctx context.Context, userID int) error {
+	return InTx(ctx, us.DB, func(ctx context.Context) error {
+		orgs := OrganizationService{DB: us.DB}
+		alone, err := orgs.ownedAlone(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+		for _, orgID := range alone {
+			_, err = conn(ctx, us.DB).ExecContext(ctx, `
+				DELETE FROM organizations
+				WHERE id = $1;`, orgID)
+			if err != nil {
+				return fmt.Errorf("delete user: %w", err)
+			}
+		}
+		for _, query := range []string{
+			// os convites enviados também cairiam pelo CASCADE, mas ficam
+			// explícitos junto com o resto
+			`DELETE FROM invitations WHERE invited_by = $1;`,
+			`DELETE FROM organization_invitations WHERE invited_by = $1;`,
+			`DELETE FROM email_outbox
+			WHERE recipient = (SELECT email FROM users WHERE id = $1);`,
+			`DELETE FROM audit_events
+			WHERE actor_id = $1
+				OR target_id = $1
+				OR email = (SELECT email FROM users WHERE id = $1);`,
+			`DELETE FROM users WHERE id = $1;`,
+		} {
+			_, err = conn(ctx, us.DB).ExecContext(ctx, query, userID)
+			if err != nil {
+				return fmt.Errorf("delete user: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteScheduled remove as contas cujo período de carência já terminou e
+// retorna quantas foram removidas. Contas que ainda são o único owner de uma
+// organização, por exemplo porque os outros owners saíram depois do pedido,
+// ficam para a próxima execução.
+func (us *UserService) DeleteScheduled(ctx context.Context) (int, error) {
+	rows, err := conn(ctx, us.DB).QueryContext(ctx, `
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at <= $1;`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("delete scheduled users: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("delete scheduled users: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("delete scheduled users: %w", err)
+	}
+	var deleted int
+	for _, id := range ids {
+		err = us.Delete(ctx, id)
+		if errors.Is(err, ErrLastOwner) {
+			slog.Warn("delete scheduled users: user is the last owner of an organization", "user_id", id)
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("delete scheduled users: %w", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// o bcrypt é lento de propósito, então ganha um span próprio para não ser
+// confundido com lentidão no banco
+func hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	tracing.End(span, err)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedBytes), nil
+}
+
+func comparePassword(ctx context.Context, hash, password string) error {
+	_, span := tracing.Start(ctx, "bcrypt.compare")
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	// senha incorreta não é uma falha do sistema
+	span.End()
+	return err
+}
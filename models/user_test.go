@@ -0,0 +1,320 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUserServiceCreate(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+
+	user, err := us.Create(f.ctx, "Jon@Example.com", testPassword)
+	if err != nil {
+		t.Fatalf("Create() err = %v", err)
+	}
+	if user.ID == 0 {
+		t.Error("Create() did not set the ID")
+	}
+	if user.Email != "jon@example.com" {
+		t.Errorf("Email = %q, want it lowercased", user.Email)
+	}
+	if user.PasswordHash == "" || user.PasswordHash == testPassword {
+		t.Errorf("PasswordHash = %q, want a bcrypt hash", user.PasswordHash)
+	}
+
+	_, err = us.Create(f.ctx, "JON@example.com", "other")
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Create() with a taken email err = %v, want %v", err, ErrEmailTaken)
+	}
+}
+
+func TestUserServiceAuthenticate(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+	created := f.userWithEmail("jon@example.com")
+
+	user, err := us.Authenticate(f.ctx, "JON@example.com", testPassword)
+	if err != nil {
+		t.Fatalf("Authenticate() err = %v", err)
+	}
+	if user.ID != created.ID || user.IsAdmin || !user.DeletionScheduledAt.IsZero() {
+		t.Errorf("Authenticate() = %+v, want user %d", user, created.ID)
+	}
+
+	_, err = us.Authenticate(f.ctx, "jon@example.com", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() with a wrong password err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	_, err = us.Authenticate(f.ctx, "nobody@example.com", testPassword)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() with an unknown email err = %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestUserServiceUpdatePassword(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+	user := f.user()
+
+	err := us.UpdatePassword(f.ctx, user.ID, "new-password")
+	if err != nil {
+		t.Fatalf("UpdatePassword() err = %v", err)
+	}
+	_, err = us.Authenticate(f.ctx, user.Email, "new-password")
+	if err != nil {
+		t.Errorf("Authenticate() with the new password err = %v", err)
+	}
+	_, err = us.Authenticate(f.ctx, user.Email, testPassword)
+	if err == nil {
+		t.Error("Authenticate() with the old password err = nil")
+	}
+}
+
+func TestUserServiceByIDAndByEmail(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+	created := f.user()
+
+	user, err := us.ByID(f.ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %v", err)
+	}
+	if user.Email != created.Email || user.PasswordHash != created.PasswordHash {
+		t.Errorf("ByID() = %+v, want %+v", user, created)
+	}
+	user, err = us.ByEmail(f.ctx, created.Email)
+	if err != nil {
+		t.Fatalf("ByEmail() err = %v", err)
+	}
+	if user.ID != created.ID {
+		t.Errorf("ByEmail() ID = %d, want %d", user.ID, created.ID)
+	}
+
+	_, err = us.ByID(f.ctx, created.ID+100)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByID() unknown err = %v, want %v", err, ErrNotFound)
+	}
+	_, err = us.ByEmail(f.ctx, "nobody@example.com")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByEmail() unknown err = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestUserServiceSetAdminAndList(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+	first := f.user()
+	second := f.user()
+
+	err := us.SetAdmin(f.ctx, second.ID, true)
+	if err != nil {
+		t.Fatalf("SetAdmin() err = %v", err)
+	}
+	users, err := us.List(f.ctx)
+	if err != nil {
+		t.Fatalf("List() err = %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("List() returned %d users, want 2", len(users))
+	}
+	if users[0].ID != first.ID || users[0].IsAdmin {
+		t.Errorf("users[0] = %+v, want non-admin user %d", users[0], first.ID)
+	}
+	if users[1].ID != second.ID || !users[1].IsAdmin {
+		t.Errorf("users[1] = %+v, want admin user %d", users[1], second.ID)
+	}
+
+	err = us.SetAdmin(f.ctx, second.ID, false)
+	if err != nil {
+		t.Fatalf("SetAdmin(false) err = %v", err)
+	}
+	user, err := us.ByID(f.ctx, second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsAdmin {
+		t.Error("user is still an admin")
+	}
+}
+
+func TestUserServiceScheduleAndCancelDeletion(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db, DeletionGracePeriod: 48 * time.Hour}
+	user := f.user()
+	f.session(user)
+
+	deleteAt, err := us.ScheduleDeletion(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ScheduleDeletion() err = %v", err)
+	}
+	assertNear(t, "deleteAt", deleteAt, time.Now().Add(48*time.Hour))
+	got, err := us.ByID(f.ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNear(t, "DeletionScheduledAt", got.DeletionScheduledAt, deleteAt)
+	if n := f.count("sessions", "user_id = $1", user.ID); n != 0 {
+		t.Errorf("%d sessions left after scheduling the deletion, want 0", n)
+	}
+
+	err = us.CancelDeletion(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("CancelDeletion() err = %v", err)
+	}
+	got, err = us.ByID(f.ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.DeletionScheduledAt.IsZero() {
+		t.Errorf("DeletionScheduledAt = %v after canceling, want zero", got.DeletionScheduledAt)
+	}
+}
+
+func TestUserServiceDelete(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+	as := AuditService{DB: f.db}
+	user := f.user()
+	other := f.user()
+	f.session(user)
+	f.passwordReset(user)
+	for _, event := range []AuditEvent{
+		{ActorID: user.ID, Action: AuditSignIn},
+		{TargetID: user.ID, Action: AuditPasswordResetRequested},
+		{Email: user.Email, Action: AuditSignInFailed},
+		{ActorID: other.ID, Action: AuditSignIn},
+	} {
+		err := as.Record(f.ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := us.Delete(f.ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Delete() err = %v", err)
+	}
+	_, err = us.ByID(f.ctx, user.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByID() after Delete() err = %v, want %v", err, ErrNotFound)
+	}
+	if n := f.count("sessions", "user_id = $1", user.ID); n != 0 {
+		t.Errorf("%d sessions left, want 0", n)
+	}
+	if n := f.count("password_resets", "user_id = $1", user.ID); n != 0 {
+		t.Errorf("%d password resets left, want 0", n)
+	}
+	if n := f.count("audit_events", "TRUE"); n != 1 {
+		t.Errorf("%d audit events left, want only the other user's", n)
+	}
+}
+
+func TestUserServiceDeleteOrganizationsAndInvitations(t *testing.T) {
+	f := newFixtures(t)
+	us := UserService{DB: f.db}
+	orgs := OrganizationService{DB: f.db}
+	shared, owner, member := newOrganization(f)
+	solo, err := orgs.Create(f.ctx, "Solo", owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := InvitationService{DB: f.db}
+	_, err = is.Create(f.ctx, "friend@example.com", owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = orgs.Invite(f.ctx, shared.ID, "colleague@example.com", RoleViewer, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := EmailOutbox{DB: f.db}
+	err = outbox.Enqueue(f.ctx, Email{To: owner.Email, Subject: "Reset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a organização com outro membro ficaria sem owner
+	_, err = us.ScheduleDeletion(f.ctx, owner.ID)
+	if !errors.Is(err, ErrLastOwner) {
+		t.Errorf("ScheduleDeletion() err = %v, want %v", err, ErrLastOwner)
+	}
+	err = us.Delete(f.ctx, owner.ID)
+	if !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("Delete() err = %v, want %v", err, ErrLastOwner)
+	}
+	if n := f.count("organizations", "TRUE"); n != 2 {
+		t.Errorf("%d organizations left after the refused Delete(), want 2", n)
+	}
+
+	err = orgs.SetRole(f.ctx, shared.ID, member.ID, RoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = us.Delete(f.ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("Delete() err = %v", err)
+	}
+	if n := f.count("organizations", "id = $1", solo.ID); n != 0 {
+		t.Errorf("organization owned only by the deleted user was kept")
+	}
+	if n := f.count("organizations", "id = $1", shared.ID); n != 1 {
+		t.Errorf("shared organization was deleted")
+	}
+	if n := f.count("invitations", "TRUE") + f.count("organization_invitations", "TRUE"); n != 0 {
+		t.Errorf("%d invitations sent by the deleted user left, want 0", n)
+	}
+	if n := f.count("email_outbox", "recipient = $1", owner.Email); n != 0 {
+		t.Errorf("%d queued emails to the deleted user left, want 0", n)
+	}
+}
+
+func TestUserServiceDeleteScheduled(t *testing.T) {
+	f := newFixtures(t)
+	// um período negativo faz a remoção já estar vencida
+	us := UserService{DB: f.db, DeletionGracePeriod: -time.Minute}
+	due := f.user()
+	later := f.user()
+	kept := f.user()
+	_, err := us.ScheduleDeletion(f.ctx, due.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.DeletionGracePeriod = time.Hour
+	_, err = us.ScheduleDeletion(f.ctx, later.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := us.DeleteScheduled(f.ctx)
+	if err != nil {
+		t.Fatalf("DeleteScheduled() err = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteScheduled() = %d, want 1", n)
+	}
+	users, err := us.List(f.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != later.ID || users[1].ID != kept.ID {
+		t.Errorf("remaining users = %+v, want %d and %d", users, later.ID, kept.ID)
+	}
+}
+
+func TestUserServiceListReadsFromReplica(t *testing.T) {
+	f := newFixtures(t)
+	replica := testDB(t)
+	f.user()
+
+	us := UserService{DB: f.db, Replica: replica}
+	users, err := us.List(f.ctx)
+	if err != nil {
+		t.Fatalf("List() err = %v", err)
+	}
+	// a "réplica" do teste é um banco vazio, então nada vem do primário
+	if len(users) != 0 {
+		t.Errorf("List() returned %d users from the primary, want the replica's 0", len(users))
+	}
+}
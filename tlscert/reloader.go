@@ -0,0 +1,124 @@
+// Package tlscert mantém o certificado TLS em memória e o recarrega do disco
+// quando os arquivos mudam ou o processo recebe um SIGHUP, sem precisar
+// reiniciar o servidor (útil com certificados renovados pelo certbot, por
+// exemplo).
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultPollInterval é o intervalo padrão em que os arquivos são verificados
+const DefaultPollInterval = time.Minute
+
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader carrega o par de certificado e chave. Um erro aqui impede o
+// servidor de subir; erros nos recarregamentos seguintes mantêm o
+// certificado anterior.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Reload lê novamente os arquivos do disco
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return fmt.Errorf("reload certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("reload certificate: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate é usado em tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch recarrega o certificado ao receber SIGHUP ou quando a data de
+// modificação dos arquivos muda, até que ctx seja cancelado. interval <= 0 usa
+// DefaultPollInterval.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				// os arquivos podem estar sendo substituídos neste momento
+				slog.Warn("checking certificate", "error", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := !modTime.Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+		}
+		err := r.Reload()
+		if err != nil {
+			slog.Error("reloading certificate, keeping the previous one", "error", err)
+			continue
+		}
+		slog.Info("TLS certificate reloaded")
+	}
+}
+
+// latestModTime retorna a modificação mais recente entre o certificado e a
+// chave, já que eles podem ser renovados separadamente
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,66 @@
+// Package urls monta os links absolutos enviados por email a partir da URL
+// pública configurada (BASE_URL). Eles nunca são derivados da requisição: com
+// um Host falso um cliente poderia pedir um reset para outra pessoa e a vítima
+// receberia um token válido apontando para o servidor do atacante.
+package urls
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL é usada por um Builder sem Base, como nas prévias dos emails
+// renderizadas fora do servidor.
+const DefaultBaseURL = "http://localhost:3000"
+
+// ErrNoBaseURL is returned by New when the base URL is empty.
+var ErrNoBaseURL = errors.New("urls: base URL is not configured")
+
+// Builder gera URLs absolutas para a aplicação. Base tem apenas o esquema e o
+// host: a aplicação é servida na raiz, já que os redirecionamentos e os links
+// das páginas usam paths absolutos.
+type Builder struct {
+	Base *url.URL
+}
+
+// New cria um Builder a partir da URL pública da aplicação
+func New(base string) (*Builder, error) {
+	if base == "" {
+		return nil, ErrNoBaseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("parse base url: %q must be an absolute http(s) URL", base)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("parse base url: %q can't have a path", base)
+	}
+	u.Path = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+	return &Builder{Base: u}, nil
+}
+
+// URL retorna o link absoluto para path com os parâmetros de query
+func (b *Builder) URL(path string, query url.Values) string {
+	var u url.URL
+	if b.Base != nil {
+		u = *b.Base
+	} else {
+		base, _ := url.Parse(DefaultBaseURL)
+		u = *base
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u.Path = path
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
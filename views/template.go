@@ -2,24 +2,21 @@ package views
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/csrf"
 	"github.com/vitoraalmeida/lenslocked/context"
+	"github.com/vitoraalmeida/lenslocked/errors"
+	"github.com/vitoraalmeida/lenslocked/metrics"
 	"github.com/vitoraalmeida/lenslocked/models"
+	"github.com/vitoraalmeida/lenslocked/tracing"
 )
 
-// usado para determinar se um erro é para usuários ou para ser mostrado internamente
-type public interface {
-	Public() string
-}
-
 type Template struct {
 	htmlTpl *template.Template
 }
@@ -34,13 +31,13 @@ func (t Template) Execute(w http.ResponseWriter, r *http.Request, data interface
 	// diferente do template
 	tpl, err := t.htmlTpl.Clone()
 	if err != nil {
-		log.Printf("cloning template: %v", err)
+		context.Logger(r.Context()).Error("cloning template", "error", err)
 		http.Error(w, "There was an error executing the template.", http.StatusInternalServerError)
 		return
 	}
 	// atualiza a função de template csrfFiel adicionada no parseFS com o conteúdo correto
 	// que é o token csrf gerado pelo gorilla csrf middleware
-	errMsgs := errMessages(errs...)
+	errMsgs := errMessages(r, errs...)
 	tpl = tpl.Funcs(
 		template.FuncMap{
 			"csrfField": func() template.HTML {
@@ -49,6 +46,9 @@ func (t Template) Execute(w http.ResponseWriter, r *http.Request, data interface
 			"currentUser": func() *models.User {
 				return context.User(r.Context())
 			},
+			"impersonator": func() *models.User {
+				return context.Impersonator(r.Context())
+			},
 			"errors": func() []string {
 				return errMsgs
 			},
@@ -62,9 +62,13 @@ func (t Template) Execute(w http.ResponseWriter, r *http.Request, data interface
 	// Quando escrevemos no response writer uma vez, na próxima vez que escrevermos (no caso
 	// o tratamento do erro abaixo) a definição do status não vai ser levada em consideração
 	// pois já foi definida antes
+	start := time.Now()
+	_, span := tracing.Start(r.Context(), "template "+t.htmlTpl.Name())
 	err = tpl.Execute(&buf, data)
+	tracing.End(span, err)
+	metrics.ObserveTemplate(t.htmlTpl.Name(), time.Since(start))
 	if err != nil {
-		log.Printf("executing template: %v", err)
+		context.Logger(r.Context()).Error("executing template", "error", err)
 		http.Error(w, "There was an error executing the template.", http.StatusInternalServerError)
 		return
 	}
@@ -109,6 +113,9 @@ func ParseFS(fs fs.FS, patterns ...string) (Template, error) {
 				// da função que de fato checa o usuário
 				return "", fmt.Errorf("currentUser not implemented")
 			},
+			"impersonator": func() (template.HTML, error) {
+				return "", fmt.Errorf("impersonator not implemented")
+			},
 			"errors": func() []string {
 				return nil
 			},
@@ -126,14 +133,14 @@ func ParseFS(fs fs.FS, patterns ...string) (Template, error) {
 	}, nil
 }
 
-func errMessages(errs ...error) []string {
+func errMessages(r *http.Request, errs ...error) []string {
 	var msgs []string
 	for _, err := range errs {
-		var pubErr public
-		if errors.As(err, &pubErr) {
-			msgs = append(msgs, pubErr.Public())
+		// só erros criados com errors.Public são mostrados aos usuários
+		if msg, ok := errors.PublicMessage(err); ok {
+			msgs = append(msgs, msg)
 		} else {
-			fmt.Println(err)
+			context.Logger(r.Context()).Error("rendering error", "error", err)
 			msgs = append(msgs, "Something went wrong.")
 		}
 	}